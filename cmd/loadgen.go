@@ -0,0 +1,224 @@
+package cmd
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"cloud.google.com/go/pubsub"
+	"github.com/karnott/pubsub-to-pubsub/forwarder"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"golang.org/x/time/rate"
+)
+
+const (
+	// param names
+	paramLoadgenTopic       = "loadgen-topic"
+	paramLoadgenCount       = "loadgen-count"
+	paramLoadgenRate        = "loadgen-rate"
+	paramLoadgenPayloadSize = "loadgen-payload-size"
+	paramLoadgenAttributes  = "loadgen-attributes"
+	paramLoadgenConcurrency = "loadgen-concurrency"
+
+	// default parameters values
+	defaultLoadgenCount       = 1000
+	defaultLoadgenPayloadSize = 1024
+	defaultLoadgenConcurrency = 10
+
+	// maxLoadgenAttributes is the maximum number of attributes of a pubsub
+	// message
+	maxLoadgenAttributes = 100
+
+	// loadgenSeqAttribute is the attribute holding the rank of a generated
+	// message, counted in the attributes of loadgen-attributes
+	loadgenSeqAttribute = "loadgen-seq"
+)
+
+// loadgenCmd publishes synthetic messages to a topic, e.g. the source topic
+// of a mapping, to measure the throughput of the forwarder
+var loadgenCmd = &cobra.Command{
+	Use:   "loadgen",
+	Short: "Publish synthetic messages to a topic at a target rate for benchmarking",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		ctx := context.Background()
+
+		topic := viper.GetString(paramLoadgenTopic)
+		count := viper.GetInt(paramLoadgenCount)
+		msgRate := viper.GetFloat64(paramLoadgenRate)
+		size := viper.GetInt(paramLoadgenPayloadSize)
+		attributes := viper.GetInt(paramLoadgenAttributes)
+		concurrency := viper.GetInt(paramLoadgenConcurrency)
+
+		var problems []string
+		if topic == "" {
+			problems = append(problems, "LOADGEN_TOPIC must be set.")
+		}
+		if count < 1 {
+			problems = append(problems, fmt.Sprintf("LOADGEN_COUNT must be at least 1, got %d.", count))
+		}
+		if msgRate < 0 {
+			problems = append(problems, fmt.Sprintf("LOADGEN_RATE must be positive or 0 for unlimited, got %g.", msgRate))
+		}
+		if size < 0 {
+			problems = append(problems, fmt.Sprintf("LOADGEN_PAYLOAD_SIZE must be positive or 0, got %d.", size))
+		}
+		if attributes < 0 || attributes > maxLoadgenAttributes {
+			problems = append(problems, fmt.Sprintf("LOADGEN_ATTRIBUTES must be between 0 and %d, got %d.", maxLoadgenAttributes, attributes))
+		}
+		if concurrency < 1 {
+			problems = append(problems, fmt.Sprintf("LOADGEN_CONCURRENCY must be at least 1, got %d.", concurrency))
+		}
+		exitOnProblems(problems, exitCodeConfig)
+
+		fromClients, _, err := forwarder.NewClientPools(ctx, cfg.Config)
+		if err != nil {
+			return fmt.Errorf("could not create pubsub clients: %w", err)
+		}
+		defer fromClients.Close()
+		client, err := fromClients.Get(ctx, cfg.FromGoogleCloudProject)
+		if err != nil {
+			return &forwarder.Error{Kind: forwarder.KindConnection, Err: fmt.Errorf("could not create pubsub client for %s %s: %w", paramFromGoogleCloudProject, cfg.FromGoogleCloudProject, err)}
+		}
+
+		payload, err := loadgenPayload(size)
+		if err != nil {
+			return err
+		}
+		t := forwarder.TopicIn(client, topic)
+		defer t.Stop()
+
+		log := logrus.
+			WithField(paramLoadgenTopic, topic).
+			WithField(paramLoadgenCount, count).
+			WithField(paramLoadgenRate, msgRate).
+			WithField(paramLoadgenPayloadSize, size).
+			WithField(paramLoadgenAttributes, attributes).
+			WithField(paramLoadgenConcurrency, concurrency)
+		log.Info("Generating load")
+
+		res := generateLoad(ctx, t, payload, count, attributes, concurrency, loadgenLimiter(msgRate, concurrency))
+		elapsed := time.Since(res.start)
+		log = log.
+			WithField("published", res.published).
+			WithField("failed", res.failed).
+			WithField("elapsed", elapsed).
+			WithField("messages-per-second", float64(res.published)/elapsed.Seconds()).
+			WithField("bytes-per-second", float64(res.published)*float64(size)/elapsed.Seconds())
+		if res.published > 0 {
+			log = log.WithField("mean-publish-latency", res.latency/time.Duration(res.published))
+		}
+		if res.failed > 0 {
+			log.Errorf("Load generated with failed publishes, last error: %v", res.err)
+			return fmt.Errorf("%d of %d publishes failed: %w", res.failed, count, res.err)
+		}
+		log.Info("Load generated")
+		return nil
+	},
+}
+
+// loadResult sums up the publishes of generateLoad
+type loadResult struct {
+	start     time.Time
+	published int64
+	failed    int64
+	// latency is the total publish latency of the published messages
+	latency time.Duration
+	// err is the last publish error
+	err error
+}
+
+// generateLoad publishes count messages of payload with attributes
+// attributes to t, from concurrency goroutines each waiting for its publish
+// to be confirmed, at the rate of limiter when set
+func generateLoad(ctx context.Context, t *pubsub.Topic, payload []byte, count, attributes, concurrency int, limiter *rate.Limiter) loadResult {
+	res := loadResult{start: time.Now()}
+	var (
+		next    int64
+		mu      sync.Mutex
+		workers sync.WaitGroup
+	)
+	for w := 0; w < concurrency; w++ {
+		workers.Add(1)
+		go func() {
+			defer workers.Done()
+			for {
+				seq := atomic.AddInt64(&next, 1)
+				if seq > int64(count) {
+					return
+				}
+				if limiter != nil {
+					if err := limiter.Wait(ctx); err != nil {
+						return
+					}
+				}
+				start := time.Now()
+				_, err := t.Publish(ctx, &pubsub.Message{Data: payload, Attributes: loadgenAttributes(seq, attributes)}).Get(ctx)
+				latency := time.Since(start)
+
+				mu.Lock()
+				if err != nil {
+					res.failed++
+					res.err = err
+				} else {
+					res.published++
+					res.latency += latency
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+	workers.Wait()
+	return res
+}
+
+// loadgenLimiter returns the limiter of msgRate messages per second, nil for
+// no limit
+func loadgenLimiter(msgRate float64, concurrency int) *rate.Limiter {
+	if msgRate == 0 {
+		return nil
+	}
+	return rate.NewLimiter(rate.Limit(msgRate), concurrency)
+}
+
+// loadgenPayload returns size random bytes, hex encoded so that the payload
+// is printable
+func loadgenPayload(size int) ([]byte, error) {
+	b := make([]byte, (size+1)/2)
+	if _, err := rand.Read(b); err != nil {
+		return nil, err
+	}
+	return []byte(hex.EncodeToString(b)[:size]), nil
+}
+
+// loadgenAttributes returns the attributes of the seq-th message: its rank
+// then attr-<i> attributes up to count attributes
+func loadgenAttributes(seq int64, count int) map[string]string {
+	if count == 0 {
+		return nil
+	}
+	attrs := make(map[string]string, count)
+	attrs[loadgenSeqAttribute] = strconv.FormatInt(seq, 10)
+	for i := 1; i < count; i++ {
+		attrs["attr-"+strconv.Itoa(i)] = strconv.Itoa(i)
+	}
+	return attrs
+}
+
+func init() {
+	loadgenCmd.Flags().String(paramLoadgenTopic, "", "topic the messages are published to, in the source project, e.g. the source topic of a mapping")
+	loadgenCmd.Flags().Int(paramLoadgenCount, defaultLoadgenCount, "number of messages published")
+	loadgenCmd.Flags().Float64(paramLoadgenRate, 0, "target rate in messages per second, 0 for as fast as possible")
+	loadgenCmd.Flags().Int(paramLoadgenPayloadSize, defaultLoadgenPayloadSize, "size in bytes of the data of each message")
+	loadgenCmd.Flags().Int(paramLoadgenAttributes, 0, "number of attributes of each message, the first one being its loadgen-seq rank")
+	loadgenCmd.Flags().Int(paramLoadgenConcurrency, defaultLoadgenConcurrency, "number of publishes awaited at once")
+	_ = viper.BindPFlags(loadgenCmd.Flags())
+
+	RootCmd.AddCommand(loadgenCmd)
+}
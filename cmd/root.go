@@ -2,15 +2,18 @@ package cmd
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"os"
+	"os/signal"
+	"path/filepath"
 	"strings"
+	"syscall"
+	"time"
 
+	"github.com/karnott/pubsub-to-pubsub/forwarder"
 	"github.com/karnott/pubsub-to-pubsub/util"
 
-	"golang.org/x/oauth2/google"
-	"google.golang.org/api/option"
-
 	"cloud.google.com/go/pubsub"
 	"github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
@@ -19,38 +22,209 @@ import (
 
 const (
 	// param names
-	paramConfig                           = "config"
-	paramLogFormat                        = "log-format"
-	paramLogLevel                         = "log-level"
-	paramFromGoogleCloudProject           = "from-google-cloud-project"
-	paramToGoogleCloudProject             = "to-google-cloud-project"
-	paramFromGoogleApplicationCredentials = "from-google-application-credentials-json"
-	paramToGoogleApplicationCredentials   = "to-google-application-credentials-json"
-	paramPubSubSubscription               = "pubsub-subscription"
-	paramPubSubDestinationTopic           = "pubsub-destination-topic"
+	paramConfig                               = "config"
+	paramConfigFormat                         = "config-format"
+	paramLogFormat                            = "log-format"
+	paramLogLevel                             = "log-level"
+	paramLogOutput                            = "log-output"
+	paramLogFields                            = "log-fields"
+	paramQuiet                                = "quiet"
+	paramLogTimestampFormat                   = "log-timestamp-format"
+	paramLogSink                              = "log-sink"
+	paramLogProject                           = "log-project"
+	paramLogName                              = "log-name"
+	paramLogResourceType                      = "log-resource-type"
+	paramLogResourceLabels                    = "log-resource-labels"
+	paramFromGoogleCloudProject               = "from-google-cloud-project"
+	paramToGoogleCloudProject                 = "to-google-cloud-project"
+	paramFromGoogleApplicationCredentials     = "from-google-application-credentials-json"
+	paramToGoogleApplicationCredentials       = "to-google-application-credentials-json"
+	paramFromGoogleApplicationCredentialsFile = "from-google-application-credentials-file"
+	paramToGoogleApplicationCredentialsFile   = "to-google-application-credentials-file"
+	paramPubSubSubscription                   = "pubsub-subscription"
+	paramPubSubDestinationTopic               = "pubsub-destination-topic"
+	paramShutdownTimeout                      = "shutdown-timeout"
+	paramMappings                             = "mappings"
+	paramPublishProfiles                      = "publish-profiles"
+	paramMetricsAddr                          = "metrics-addr"
+	paramAttributeAllowlist                   = "attribute-allowlist"
+	paramAttributeBlocklist                   = "attribute-blocklist"
+	paramAttributeMapping                     = "attribute-mapping"
+	paramMaxOutstandingMessages               = "max-outstanding-messages"
+	paramMaxOutstandingBytes                  = "max-outstanding-bytes"
+	paramDeadLetterTopic                      = "dead-letter-topic"
+	paramMaxPublishRetries                    = "max-publish-retries"
+	paramPublishMaxAttempts                   = "publish-max-attempts"
+	paramPublishInitialBackoff                = "publish-initial-backoff"
+	paramPublishMaxBackoff                    = "publish-max-backoff"
+	paramHealthAddr                           = "health-addr"
+	paramTransformCEL                         = "transform-cel"
+	paramDryRun                               = "dry-run"
+	paramDryRunAck                            = "dry-run-ack"
+	paramDestinationType                      = "destination-type"
+	paramPubSubLiteLocation                   = "pubsublite-location"
+	paramEmulatorHost                         = "emulator-host"
+	paramFilterAttribute                      = "filter-attribute"
+	paramFilterValues                         = "filter-values"
+	paramFilterCaseInsensitive                = "filter-case-insensitive"
+	paramDataMatchRegex                       = "data-match-regex"
+	paramMinPublishTime                       = "min-publish-time"
+	paramPanicFatal                           = "panic-fatal"
+	paramSampleRate                           = "sample-rate"
+	paramSampleDeterministic                  = "sample-deterministic"
+	paramSampleAttribute                      = "sample-attribute"
+	paramPublishCountThreshold                = "publish-count-threshold"
+	paramPublishByteThreshold                 = "publish-byte-threshold"
+	paramPublishDelayThreshold                = "publish-delay-threshold"
+	paramPublishAsyncAck                      = "publish-async-ack"
+	paramEndpoint                             = "endpoint"
+	paramCACertFile                           = "ca-cert-file"
+	paramClientCertFile                       = "client-cert-file"
+	paramClientKeyFile                        = "client-key-file"
+	paramLogCaller                            = "log-caller"
+	paramCheck                                = "check"
+	paramDynamicTopicAttribute                = "dynamic-topic-attribute"
+	paramMirrorTopic                          = "mirror-topic"
+	paramMirrorTopicPrefix                    = "mirror-topic-prefix"
+	paramMirrorTopicSuffix                    = "mirror-topic-suffix"
+	paramTopicTemplate                        = "topic-template"
+	paramReceiveMaxRetries                    = "receive-max-retries"
+	paramReceiveBackoffMax                    = "receive-backoff-max"
+	paramReceiveAuthRetries                   = "receive-auth-retries"
+	paramFanOutMode                           = "fan-out-mode"
+	paramOtelEndpoint                         = "otel-endpoint"
+	paramOtelInsecure                         = "otel-insecure"
+	paramDestinationFile                      = "destination-file"
+	paramDestinationFileMaxBytes              = "destination-file-max-bytes"
+	paramDecompressGzip                       = "decompress-gzip"
+	paramCompressGzip                         = "compress-gzip"
+	paramEnv                                  = "env"
+	paramMaxMessageBytes                      = "max-message-bytes"
+	paramPublishConcurrency                   = "publish-concurrency"
+	paramReceiveGoroutines                    = "receive-goroutines"
+	paramSynchronousPull                      = "synchronous-pull"
+	paramInjectAttributes                     = "inject-attributes"
+	paramInjectForwardedTimestamp             = "inject-forwarded-timestamp"
+	paramPreservePublishTime                  = "preserve-publish-time"
+	paramPublishTimeAttribute                 = "publish-time-attribute"
+	paramStampSequence                        = "stamp-sequence"
+	paramFlowControlBehavior                  = "flow-control-behavior"
+	paramAckMode                              = "ack-mode"
+	paramValidateSchema                       = "validate-schema"
+	paramSchemaFile                           = "schema-file"
+	paramSchemaEncoding                       = "schema-encoding"
+	paramMaxPublishRate                       = "max-publish-rate"
+	paramPublishBurst                         = "publish-burst"
+	paramDedupWindow                          = "dedup-window"
+	paramDedupSize                            = "dedup-size"
+	paramDedupAttribute                       = "dedup-attribute"
+	paramPublishTimeout                       = "publish-timeout"
+	paramErrorLogSample                       = "error-log-sample"
+	paramInputCodec                           = "input-codec"
+	paramEnvelopeTemplate                     = "envelope-template"
+	paramOutputCodec                          = "output-codec"
+	paramCodecSchemaFile                      = "codec-schema-file"
+	paramAdminAddr                            = "admin-addr"
+	paramAdminToken                           = "admin-token"
+	paramAdminTLSCert                         = "admin-tls-cert"
+	paramAdminTLSKey                          = "admin-tls-key"
+	paramBigQueryProject                      = "bq-project"
+	paramBigQueryDataset                      = "bq-dataset"
+	paramBigQueryTable                        = "bq-table"
+	paramBigQueryFlushInterval                = "bq-flush-interval"
+	paramRunDuration                          = "run-duration"
+	paramFromCredentialsKMSKey                = "from-credentials-kms-key"
+	paramToCredentialsKMSKey                  = "to-credentials-kms-key"
+	paramMaxMessageAgeWarn                    = "max-message-age-warn"
+	paramRedeliveryTrackSize                  = "redelivery-track-size"
+	paramRedeliveryWarn                       = "redelivery-warn"
+	paramRequireAttributes                    = "require-attributes"
+	paramGRPCKeepaliveTime                    = "grpc-keepalive-time"
+	paramGRPCKeepaliveTimeout                 = "grpc-keepalive-timeout"
+	paramGRPCConnectionPool                   = "grpc-connection-pool"
+	paramDrainIdle                            = "drain-idle"
+	paramMaxMessages                          = "max-messages"
+	paramMaxBytes                             = "max-bytes"
+	paramOrderingKeyAttribute                 = "ordering-key-attribute"
+	paramIgnoreOrdering                       = "ignore-ordering"
+	paramCircuitFailureThreshold              = "circuit-failure-threshold"
+	paramCircuitResetTimeout                  = "circuit-reset-timeout"
+	paramDestinationURL                       = "destination-url"
+	paramDestinationTimeout                   = "destination-timeout"
+	paramDestinationToken                     = "destination-token"
+	paramKafkaBrokers                         = "kafka-brokers"
+	paramKafkaTopic                           = "kafka-topic"
+	paramKafkaKeyAttribute                    = "kafka-key-attribute"
+	paramKafkaSASLMechanism                   = "kafka-sasl-mechanism"
+	paramKafkaSASLUsername                    = "kafka-sasl-username"
+	paramKafkaSASLPassword                    = "kafka-sasl-password"
+	paramKafkaTLS                             = "kafka-tls"
+	paramKafkaCACertFile                      = "kafka-ca-cert-file"
+	paramListAvailable                        = "list-available"
+	paramFromCredentialsSecret                = "from-credentials-secret"
+	paramToCredentialsSecret                  = "to-credentials-secret"
+	paramMaxInflightPerKey                    = "max-inflight-per-key"
+	paramBacklogLogInterval                   = "backlog-log-interval"
+	paramNackDelay                            = "nack-delay"
 
 	// default parameters values
-	defaultLogLevel  = "debug"
-	defaultLogFormat = "json"
+	defaultLogLevel        = "debug"
+	defaultLogFormat       = "json"
+	defaultLogOutput       = "stderr"
+	defaultLogName         = "pubsub-to-pubsub"
+	defaultLogResourceType = "global"
+	defaultShutdownTimeout = 30 * time.Second
+	defaultDestinationType = forwarder.DestinationTypePubSub
 
-	pubSubMaxOutstandingMessages = 10
+	defaultMaxOutstandingMessages = 10
+	defaultMaxPublishRetries      = 5
+	defaultPublishMaxAttempts     = 1
+	defaultPublishInitialBackoff  = 100 * time.Millisecond
+	defaultPublishMaxBackoff      = 10 * time.Second
+	defaultReceiveBackoffMax      = time.Minute
+	defaultReceiveAuthRetries     = 3
+	defaultFanOutMode             = forwarder.FanOutModeAll
+	defaultMaxMessageBytes        = 10 * 1000 * 1000
+	defaultFlowControlBehavior    = forwarder.FlowControlBlock
+	defaultAckMode                = forwarder.AckModeOnSuccess
+	defaultSchemaEncoding         = forwarder.SchemaEncodingJSON
+	defaultPublishBurst           = 1
+	defaultDedupSize              = 100000
+	defaultRedeliveryTrackSize    = 100000
+	defaultPublishTimeout         = 30 * time.Second
+	defaultBigQueryFlushInterval  = time.Second
+	defaultCircuitResetTimeout    = 30 * time.Second
+	defaultDestinationTimeout     = 10 * time.Second
+	defaultPublishTimeAttribute   = "original_publish_time"
 )
 
 // Config configuration
 type Config struct {
-	LogFormat                        string
-	LogLevel                         string
-	FromGoogleCloudProject           string
-	ToGoogleCloudProject             string
-	FromGoogleApplicationCredentials string
-	ToGoogleApplicationCredentials   string
-	PubSubSubscription               string
-	PubSubDestinationTopic           string
+	forwarder.Config
+
+	LogFormat              string
+	LogLevel               string
+	LogOutput              string
+	LogFields              []string
+	Quiet                  bool
+	LogTimestampFormat     string
+	LogSink                string
+	LogProject             string
+	LogName                string
+	LogResourceType        string
+	LogResourceLabels      []string
+	LogCaller              bool
+	Check                  bool
+	Env                    string
+	FromGoogleCloudProject string
+	ToGoogleCloudProject   string
+	PubSubSubscription     string
+	PubSubDestinationTopic string
 }
 
 var (
-	cfgFile string
-	cfg     = &Config{}
+	cfgFiles []string
+	cfg      = &Config{}
 )
 
 // RootCmd represents the base command when called without any subcommands
@@ -58,99 +232,385 @@ var RootCmd = &cobra.Command{
 	Use:   "pubsub-to-pubsub",
 	Short: "pubsub-to-pubsub",
 	Long:  "pubsub-to-pubsub",
-	Run: func(cmd *cobra.Command, args []string) {
-		ctx := context.Background()
-
-		util.SetLogger(cfg.LogLevel, cfg.LogFormat)
+	PersistentPreRun: func(cmd *cobra.Command, args []string) {
+		level := cfg.LogLevel
+		if cfg.Quiet {
+			level = logrus.ErrorLevel.String()
+		}
+		util.SetLogger(level, cfg.LogFormat, cfg.LogTimestampFormat, cfg.LogOutput, cfg.LogCaller, cfg.LogFields)
+		util.SetLogSink(cfg.LogSink, cfg.LogProject, cfg.LogName, cfg.LogResourceType, cfg.LogResourceLabels)
+	},
+	// errors are logged by Execute, which maps them to an exit code
+	SilenceUsage:  true,
+	SilenceErrors: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+		defer stop()
 
 		logrus.
-			WithField(paramConfig, cfgFile).
+			WithField(paramConfig, viper.GetString(paramConfig)).
+			WithField(paramConfigFormat, viper.GetString(paramConfigFormat)).
 			WithField(paramLogLevel, cfg.LogLevel).
 			WithField(paramLogFormat, cfg.LogFormat).
+			WithField(paramLogOutput, cfg.LogOutput).
+			WithField(paramLogFields, cfg.LogFields).
+			WithField(paramQuiet, cfg.Quiet).
+			WithField(paramLogTimestampFormat, cfg.LogTimestampFormat).
+			WithField(paramLogSink, cfg.LogSink).
+			WithField(paramLogProject, cfg.LogProject).
+			WithField(paramLogName, cfg.LogName).
+			WithField(paramLogResourceType, cfg.LogResourceType).
+			WithField(paramLogResourceLabels, cfg.LogResourceLabels).
 			WithField(paramFromGoogleCloudProject, cfg.FromGoogleCloudProject).
 			WithField(paramToGoogleCloudProject, cfg.ToGoogleCloudProject).
-			WithField(paramFromGoogleApplicationCredentials, cfg.FromGoogleApplicationCredentials).
-			WithField(paramToGoogleApplicationCredentials, cfg.ToGoogleApplicationCredentials).
+			WithField(paramFromGoogleApplicationCredentials, redactCredentials(cfg.FromGoogleApplicationCredentials)).
+			WithField(paramToGoogleApplicationCredentials, redactCredentials(cfg.ToGoogleApplicationCredentials)).
+			WithField(paramFromGoogleApplicationCredentialsFile, cfg.FromGoogleApplicationCredentialsFile).
+			WithField(paramToGoogleApplicationCredentialsFile, cfg.ToGoogleApplicationCredentialsFile).
 			WithField(paramPubSubSubscription, cfg.PubSubSubscription).
 			WithField(paramPubSubDestinationTopic, cfg.PubSubDestinationTopic).
+			WithField(paramShutdownTimeout, cfg.ShutdownTimeout).
+			WithField(paramMappings, cfg.Mappings).
+			WithField(paramPublishProfiles, cfg.PublishProfiles).
+			WithField(paramMetricsAddr, cfg.MetricsAddr).
+			WithField(paramAttributeAllowlist, cfg.AttributeAllowlist).
+			WithField(paramAttributeBlocklist, cfg.AttributeBlocklist).
+			WithField(paramAttributeMapping, cfg.AttributeMapping).
+			WithField(paramMaxOutstandingMessages, cfg.MaxOutstandingMessages).
+			WithField(paramMaxOutstandingBytes, cfg.MaxOutstandingBytes).
+			WithField(paramDeadLetterTopic, cfg.DeadLetterTopic).
+			WithField(paramMaxPublishRetries, cfg.MaxPublishRetries).
+			WithField(paramPublishMaxAttempts, cfg.PublishMaxAttempts).
+			WithField(paramPublishInitialBackoff, cfg.PublishInitialBackoff).
+			WithField(paramPublishMaxBackoff, cfg.PublishMaxBackoff).
+			WithField(paramHealthAddr, cfg.HealthAddr).
+			WithField(paramTransformCEL, cfg.TransformCEL).
+			WithField(paramDryRun, cfg.DryRun).
+			WithField(paramDryRunAck, cfg.DryRunAck).
+			WithField(paramDestinationType, cfg.DestinationType).
+			WithField(paramPubSubLiteLocation, cfg.PubSubLiteLocation).
+			WithField(paramEmulatorHost, cfg.EmulatorHost).
+			WithField(paramFilterAttribute, cfg.FilterAttribute).
+			WithField(paramFilterValues, cfg.FilterValues).
+			WithField(paramFilterCaseInsensitive, cfg.FilterCaseInsensitive).
+			WithField(paramDataMatchRegex, cfg.DataMatchRegex).
+			WithField(paramMinPublishTime, cfg.MinPublishTime).
+			WithField(paramPanicFatal, cfg.PanicFatal).
+			WithField(paramSampleRate, cfg.SampleRate).
+			WithField(paramSampleDeterministic, cfg.SampleDeterministic).
+			WithField(paramSampleAttribute, cfg.SampleAttribute).
+			WithField(paramPublishCountThreshold, cfg.PublishCountThreshold).
+			WithField(paramPublishByteThreshold, cfg.PublishByteThreshold).
+			WithField(paramPublishDelayThreshold, cfg.PublishDelayThreshold).
+			WithField(paramPublishAsyncAck, cfg.PublishAsyncAck).
+			WithField(paramEndpoint, cfg.Endpoint).
+			WithField(paramCACertFile, cfg.CACertFile).
+			WithField(paramClientCertFile, cfg.ClientCertFile).
+			WithField(paramClientKeyFile, cfg.ClientKeyFile).
+			WithField(paramLogCaller, cfg.LogCaller).
+			WithField(paramDynamicTopicAttribute, cfg.DynamicTopicAttribute).
+			WithField(paramMirrorTopic, cfg.MirrorTopic).
+			WithField(paramMirrorTopicPrefix, cfg.MirrorTopicPrefix).
+			WithField(paramMirrorTopicSuffix, cfg.MirrorTopicSuffix).
+			WithField(paramTopicTemplate, cfg.TopicTemplate).
+			WithField(paramReceiveMaxRetries, cfg.ReceiveMaxRetries).
+			WithField(paramReceiveBackoffMax, cfg.ReceiveBackoffMax).
+			WithField(paramReceiveAuthRetries, cfg.ReceiveAuthRetries).
+			WithField(paramFanOutMode, cfg.FanOutMode).
+			WithField(paramOtelEndpoint, cfg.OtelEndpoint).
+			WithField(paramOtelInsecure, cfg.OtelInsecure).
+			WithField(paramDestinationFile, cfg.DestinationFile).
+			WithField(paramDestinationFileMaxBytes, cfg.DestinationFileMaxBytes).
+			WithField(paramDecompressGzip, cfg.DecompressGzip).
+			WithField(paramCompressGzip, cfg.CompressGzip).
+			WithField(paramEnv, cfg.Env).
+			WithField(paramMaxMessageBytes, cfg.MaxMessageBytes).
+			WithField(paramPublishConcurrency, cfg.PublishConcurrency).
+			WithField(paramReceiveGoroutines, cfg.ReceiveGoroutines).
+			WithField(paramSynchronousPull, cfg.SynchronousPull).
+			WithField(paramInjectAttributes, cfg.InjectAttributes).
+			WithField(paramInjectForwardedTimestamp, cfg.InjectForwardedTimestamp).
+			WithField(paramPreservePublishTime, cfg.PreservePublishTime).
+			WithField(paramPublishTimeAttribute, cfg.PublishTimeAttribute).
+			WithField(paramStampSequence, cfg.StampSequence).
+			WithField(paramFlowControlBehavior, cfg.FlowControlBehavior).
+			WithField(paramAckMode, cfg.AckMode).
+			WithField(paramValidateSchema, cfg.ValidateSchema).
+			WithField(paramSchemaFile, cfg.SchemaFile).
+			WithField(paramSchemaEncoding, cfg.SchemaEncoding).
+			WithField(paramMaxPublishRate, cfg.MaxPublishRate).
+			WithField(paramPublishBurst, cfg.PublishBurst).
+			WithField(paramDedupWindow, cfg.DedupWindow).
+			WithField(paramDedupSize, cfg.DedupSize).
+			WithField(paramDedupAttribute, cfg.DedupAttribute).
+			WithField(paramPublishTimeout, cfg.PublishTimeout).
+			WithField(paramErrorLogSample, cfg.ErrorLogSample).
+			WithField(paramInputCodec, cfg.InputCodec).
+			WithField(paramOutputCodec, cfg.OutputCodec).
+			WithField(paramCodecSchemaFile, cfg.CodecSchemaFile).
+			WithField(paramAdminAddr, cfg.AdminAddr).
+			WithField(paramEnvelopeTemplate, cfg.EnvelopeTemplate).
+			WithField(paramAdminTLSCert, cfg.AdminTLSCert).
+			WithField(paramAdminTLSKey, cfg.AdminTLSKey).
+			WithField(paramBigQueryProject, cfg.BigQueryProject).
+			WithField(paramBigQueryDataset, cfg.BigQueryDataset).
+			WithField(paramBigQueryTable, cfg.BigQueryTable).
+			WithField(paramBigQueryFlushInterval, cfg.BigQueryFlushInterval).
+			WithField(paramRunDuration, cfg.RunDuration).
+			WithField(paramFromCredentialsKMSKey, cfg.FromCredentialsKMSKey).
+			WithField(paramToCredentialsKMSKey, cfg.ToCredentialsKMSKey).
+			WithField(paramMaxMessageAgeWarn, cfg.MaxMessageAgeWarn).
+			WithField(paramRedeliveryTrackSize, cfg.RedeliveryTrackSize).
+			WithField(paramRedeliveryWarn, cfg.RedeliveryWarn).
+			WithField(paramRequireAttributes, cfg.RequireAttributes).
+			WithField(paramGRPCKeepaliveTime, cfg.GRPCKeepaliveTime).
+			WithField(paramGRPCKeepaliveTimeout, cfg.GRPCKeepaliveTimeout).
+			WithField(paramGRPCConnectionPool, cfg.GRPCConnectionPool).
+			WithField(paramDrainIdle, cfg.DrainIdle).
+			WithField(paramMaxMessages, cfg.MaxMessages).
+			WithField(paramMaxBytes, cfg.MaxBytes).
+			WithField(paramOrderingKeyAttribute, cfg.OrderingKeyAttribute).
+			WithField(paramIgnoreOrdering, cfg.IgnoreOrdering).
+			WithField(paramCircuitFailureThreshold, cfg.CircuitFailureThreshold).
+			WithField(paramCircuitResetTimeout, cfg.CircuitResetTimeout).
+			WithField(paramDestinationURL, cfg.DestinationURL).
+			WithField(paramDestinationTimeout, cfg.DestinationTimeout).
+			WithField(paramKafkaBrokers, cfg.KafkaBrokers).
+			WithField(paramKafkaTopic, cfg.KafkaTopic).
+			WithField(paramKafkaKeyAttribute, cfg.KafkaKeyAttribute).
+			WithField(paramKafkaSASLMechanism, cfg.KafkaSASLMechanism).
+			WithField(paramKafkaSASLUsername, cfg.KafkaSASLUsername).
+			WithField(paramKafkaTLS, cfg.KafkaTLS).
+			WithField(paramKafkaCACertFile, cfg.KafkaCACertFile).
+			WithField(paramListAvailable, cfg.ListAvailable).
+			WithField(paramFromCredentialsSecret, cfg.FromCredentialsSecret).
+			WithField(paramToCredentialsSecret, cfg.ToCredentialsSecret).
+			WithField(paramMaxInflightPerKey, cfg.MaxInflightPerKey).
+			WithField(paramBacklogLogInterval, cfg.BacklogLogInterval).
+			WithField(paramNackDelay, cfg.NackDelay).
 			Debug("Configuration")
 
-		if cfg.FromGoogleCloudProject == "" {
-			_, _ = fmt.Fprintf(os.Stderr, "FROM_GOOGLE_CLOUD_PROJECT variable must be set.\n")
-			os.Exit(1)
+		exitOnProblems(cfg.Validate(), exitCodeConfig)
+		if cfg.Check {
+			exitOnProblems(cfg.ValidateCredentials(ctx), exitCodeCredentials)
+			_, _ = fmt.Fprintln(os.Stdout, "Configuration is valid.")
+			return nil
 		}
 
-		if cfg.ToGoogleCloudProject == "" {
-			_, _ = fmt.Fprintf(os.Stderr, "TO_GOOGLE_CLOUD_PROJECT variable must be set.\n")
-			os.Exit(1)
-		}
-
-		if cfg.PubSubSubscription == "" {
-			_, _ = fmt.Fprintf(os.Stderr, "PUBSUB_SUBSCRIPTION variable must be set.\n")
-			os.Exit(1)
-		}
-		if cfg.PubSubDestinationTopic == "" {
-			_, _ = fmt.Fprintf(os.Stderr, "PUBSUB_DESTINATION_TOPIC variable must be set.\n")
-			os.Exit(1)
-		}
-
-		fromCreds, err := google.CredentialsFromJSON(ctx, []byte(cfg.FromGoogleApplicationCredentials), pubsub.ScopePubSub)
-		toCreds, err := google.CredentialsFromJSON(ctx, []byte(cfg.ToGoogleApplicationCredentials), pubsub.ScopePubSub)
-
+		f, err := forwarder.New(cfg.Config)
 		if err != nil {
-			logrus.Fatalf("Could not find credentials: %v", err)
-			os.Exit(1)
+			return fmt.Errorf("could not create forwarder: %w", err)
 		}
-
-		fromClient, err := pubsub.NewClient(ctx, cfg.FromGoogleCloudProject, option.WithCredentials(fromCreds))
-		toClient, err := pubsub.NewClient(ctx, cfg.ToGoogleCloudProject, option.WithCredentials(toCreds))
-
-		if err != nil {
-			logrus.Fatalf("Could not create pubsub Client: %v", err)
-			os.Exit(1)
+		go reloadOnHangup(ctx, f)
+		if err := f.Run(ctx); err != nil {
+			return err
 		}
+		logrus.Info("Shutdown complete")
+		return nil
+	},
+}
 
-		sub := fromClient.Subscription(cfg.PubSubSubscription)
-		sub.ReceiveSettings.MaxOutstandingMessages = pubSubMaxOutstandingMessages
-
-		topic := toClient.Topic(cfg.PubSubDestinationTopic)
-
-		err = sub.Receive(ctx, func(ctx context.Context, msg *pubsub.Message) {
-			if _, err = topic.Publish(ctx, msg).Get(ctx); err == nil {
-				msg.Ack()
-			} else {
-				logrus.Errorf("err when inserting data: %v", err)
-				msg.Nack()
+// reloadOnHangup reloads the credentials of f on every SIGHUP until ctx is
+// done, so that rotated keys are used without a restart
+func reloadOnHangup(ctx context.Context, f *forwarder.Forwarder) {
+	hangup := make(chan os.Signal, 1)
+	signal.Notify(hangup, syscall.SIGHUP)
+	defer signal.Stop(hangup)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-hangup:
+			if err := f.ReloadCredentials(ctx); err != nil {
+				logrus.Errorf("%v, previous credentials are kept", err)
 			}
-		})
-
-		if err != nil {
-			logrus.Fatal(err)
 		}
-	},
+	}
 }
 
+// exit codes, documented in the README
+const (
+	exitCodeError       = 1
+	exitCodeConfig      = 2
+	exitCodeCredentials = 3
+	exitCodeConnection  = 4
+)
+
 // Execute adds all child commands to the root command sets flags appropriately.
 // This is called by main.main(). It only needs to happen once to the rootCmd.
 func Execute() {
-	if err := RootCmd.Execute(); err != nil {
+	err := RootCmd.Execute()
+	if err != nil {
 		logrus.Error(err)
-		os.Exit(-1)
+	}
+	util.CloseLogSink()
+	if err != nil {
+		os.Exit(exitCode(err))
+	}
+}
+
+// exitCode returns the exit code of the kind of err
+func exitCode(err error) int {
+	switch forwarder.KindOf(err) {
+	case forwarder.KindConfig:
+		return exitCodeConfig
+	case forwarder.KindCredentials:
+		return exitCodeCredentials
+	case forwarder.KindConnection:
+		return exitCodeConnection
+	default:
+		return exitCodeError
 	}
 }
 
 func init() {
 	cobra.OnInitialize(initConfig)
 
-	RootCmd.PersistentFlags().StringVar(&cfgFile, paramConfig, "", "Config file. All flags given in command line will override the values from this file.")
+	RootCmd.Flags().Bool(paramCheck, false, "validate the configuration and exit without connecting to pubsub")
+	_ = viper.BindPFlag(paramCheck, RootCmd.Flags().Lookup(paramCheck))
+
+	RootCmd.PersistentFlags().StringSliceVar(&cfgFiles, paramConfig, nil, "Config file, repeatable, later files overriding earlier ones. All flags given in command line will override the values from these files.")
+	_ = viper.BindPFlag(paramConfig, RootCmd.PersistentFlags().Lookup(paramConfig))
+	configureFlag(paramConfigFormat, "", "format of the config files and overlay, yaml, json or toml, inferred from their extension when empty")
+	configureFlag(paramEnv, "", "environment whose config.<env> overlay is merged over the config file")
 	configureFlag(paramLogFormat, defaultLogFormat, "Log format")
 	configureFlag(paramLogLevel, defaultLogLevel, "Log level")
+	configureFlag(paramLogOutput, defaultLogOutput, "Log output, stdout, stderr or the path of a file logs are appended to")
+	configureListFlag(paramLogFields, "key=value fields added to every log line, e.g. service=pubsub-to-pubsub,environment=prod")
+	configureBoolFlag(paramQuiet, false, "only log errors, whatever the log level, e.g. for cron jobs")
+	configureFlag(paramLogTimestampFormat, util.TimestampRFC3339, "Log timestamp format, rfc3339, rfc3339nano, epoch for milliseconds since the epoch in json logs, or a Go time layout")
+	configureFlag(paramLogSink, util.LogSinkOutput, "Log sink, output to write the formatted logs to the log output or stackdriver to send them to Cloud Logging")
+	configureFlag(paramLogProject, "", "project of the Cloud Logging log of the stackdriver sink, the project of the default credentials when empty")
+	configureFlag(paramLogName, defaultLogName, "name of the Cloud Logging log of the stackdriver sink")
+	configureFlag(paramLogResourceType, defaultLogResourceType, "type of the monitored resource of the stackdriver sink logs, e.g. k8s_container")
+	configureListFlag(paramLogResourceLabels, "key=value labels of the monitored resource of the stackdriver sink logs, e.g. project_id=p,cluster_name=c")
+	configureBoolFlag(paramLogCaller, false, "include the source file and line in logs")
 	configureFlag(paramFromGoogleCloudProject, "", "google cloud project where subscription is defined")
 	configureFlag(paramToGoogleCloudProject, "", "google cloud project where destination topic is defined")
-	configureFlag(paramFromGoogleApplicationCredentials, "", "google cloud credentials to use for subscription access")
-	configureFlag(paramToGoogleApplicationCredentials, "", "google cloud credentials to use for publication access")
+	configureFlag(paramFromGoogleApplicationCredentials, "", "google cloud credentials to use for subscription access, application default credentials are used when empty")
+	configureFlag(paramToGoogleApplicationCredentials, "", "google cloud credentials to use for publication access, application default credentials are used when empty")
+	configureFlag(paramFromGoogleApplicationCredentialsFile, "", "path to the google cloud credentials file to use for subscription access")
+	configureFlag(paramToGoogleApplicationCredentialsFile, "", "path to the google cloud credentials file to use for publication access")
 	configureFlag(paramPubSubSubscription, "", "google cloud subscription")
-	configureFlag(paramPubSubDestinationTopic, "", "google cloud destination topic")
+	configureListFlag(paramPubSubDestinationTopic, "google cloud destination topics, messages are published to all of them")
+	configureFlag(paramMetricsAddr, "", "address to serve prometheus metrics on (e.g. :9090), disabled when empty")
+	configureFlag(paramHealthAddr, "", "address to serve the /healthz and /readyz probes on (e.g. :8080), disabled when empty")
+	configureListFlag(paramAttributeAllowlist, "comma separated list of message attributes to forward, all attributes are forwarded when empty")
+	configureListFlag(paramAttributeBlocklist, "comma separated list of message attributes to never forward")
+	configureListFlag(paramAttributeMapping, "comma separated list of from=to renames of the forwarded message attributes, from= dropping the attribute")
+	configureIntFlag(paramMaxOutstandingMessages, defaultMaxOutstandingMessages, "maximum number of unprocessed messages, -1 for unlimited")
+	configureIntFlag(paramMaxOutstandingBytes, pubsub.DefaultReceiveSettings.MaxOutstandingBytes, "maximum size in bytes of unprocessed messages, -1 for unlimited")
+	configureFlag(paramFilterAttribute, "", "message attribute checked against the filter values, messages not matching are acked without being published")
+	configureListFlag(paramFilterValues, "comma separated list of accepted values of the filter attribute")
+	configureBoolFlag(paramFilterCaseInsensitive, false, "compare filter values ignoring case")
+	configureFlag(paramDataMatchRegex, "", "regular expression matched against the message data, messages not matching are acked without being published")
+	configureFlag(paramMinPublishTime, "", "RFC3339 timestamp, messages published before it are acked without being published")
+	configureBoolFlag(paramPanicFatal, false, "crash on a panic when handling a message instead of nacking the message, for debugging")
+	configureFloatFlag(paramSampleRate, 1, "fraction of the messages forwarded, above 0 and at most 1, the others being acked without being published, 1 forwarding every message")
+	configureBoolFlag(paramSampleDeterministic, false, "sample messages on a hash of their ID or sample attribute instead of at random, so that a redelivered message gets the same decision")
+	configureFlag(paramSampleAttribute, "", "message attribute hashed instead of the ID by deterministic sampling")
+	configureFlag(paramTransformCEL, "", "CEL expression rewriting messages, given data, text and attributes it returns a map with optional data and attributes entries")
+	configureBoolFlag(paramDryRun, false, "log received messages instead of publishing them")
+	configureBoolFlag(paramDryRunAck, true, "ack messages in dry run mode, nack them otherwise")
+	configureFlag(paramDestinationType, defaultDestinationType, "type of the destination, pubsub, pubsublite, file, bigquery, http or kafka")
+	configureFlag(paramPubSubLiteLocation, "", "region or zone of the pubsub lite destination topic")
+	configureFlag(paramEmulatorHost, "", "host:port of a pubsub emulator to use instead of google cloud, defaults to PUBSUB_EMULATOR_HOST")
+	configureFlag(paramDeadLetterTopic, "", "google cloud topic, in the destination project, receiving messages that repeatedly fail to publish")
+	configureIntFlag(paramMaxPublishRetries, defaultMaxPublishRetries, "number of failed publishes before a message is sent to the dead-letter topic")
+	configureIntFlag(paramPublishMaxAttempts, defaultPublishMaxAttempts, "number of publish attempts for a message before it is nacked")
+	configureDurationFlag(paramPublishInitialBackoff, defaultPublishInitialBackoff, "delay before the first publish retry, doubled on each retry")
+	configureDurationFlag(paramPublishMaxBackoff, defaultPublishMaxBackoff, "maximum delay between publish retries")
+	configureIntFlag(paramPublishCountThreshold, pubsub.DefaultPublishSettings.CountThreshold, "number of messages triggering the publish of a batch, pubsub destinations only")
+	configureIntFlag(paramPublishByteThreshold, pubsub.DefaultPublishSettings.ByteThreshold, "size in bytes triggering the publish of a batch, pubsub destinations only")
+	configureDurationFlag(paramPublishDelayThreshold, pubsub.DefaultPublishSettings.DelayThreshold, "delay after which a non-empty batch is published, pubsub destinations only")
+	configureBoolFlag(paramPublishAsyncAck, false, "return from the receive callback right after queueing the publish and ack once the server confirms it")
+	configureFlag(paramEndpoint, "", "custom pubsub endpoint (host:port) used by both clients")
+	configureFlag(paramCACertFile, "", "path to a PEM CA bundle trusted to verify the pubsub endpoint")
+	configureFlag(paramClientCertFile, "", "path to a PEM client certificate presented to the pubsub endpoint")
+	configureFlag(paramClientKeyFile, "", "path to the PEM key of the client certificate")
+	configureFlag(paramDynamicTopicAttribute, "", "message attribute holding the destination topic, the mapping destination topic becomes the default topic of messages without it")
+	configureBoolFlag(paramMirrorTopic, false, "publish the messages of each subscription to the topic of the destination project named after the topic of the subscription, instead of pubsub-destination-topic")
+	configureFlag(paramMirrorTopicPrefix, "", "prefix of the mirrored topic names")
+	configureFlag(paramMirrorTopicSuffix, "", "suffix of the mirrored topic names")
+	configureFlag(paramTopicTemplate, "", "destination topic name built from the dynamic topic attribute, e.g. events-{tenant}")
+	configureIntFlag(paramReceiveMaxRetries, 0, "number of retries after the receive loop fails with a transient error, 0 for unlimited")
+	configureDurationFlag(paramReceiveBackoffMax, defaultReceiveBackoffMax, "maximum delay between retries of the receive loop")
+	configureFlag(paramFanOutMode, defaultFanOutMode, "with several destination topics, ack messages published to all of them or to any of them")
+	configureIntFlag(paramReceiveAuthRetries, defaultReceiveAuthRetries, "number of retries, reloading the source credentials, after the receive loop fails with an unauthenticated or permission denied error, 0 to fail right away")
+	configureFlag(paramOtelEndpoint, "", "OTLP gRPC endpoint to export traces to, tracing is disabled when empty")
+	configureBoolFlag(paramOtelInsecure, false, "export traces without TLS")
+	configureFlag(paramDestinationFile, "", "path of the JSON lines file messages are written to when destination-type is file")
+	configureIntFlag(paramDestinationFileMaxBytes, 0, "size at which the destination file is rotated, 0 to never rotate")
+	configureBoolFlag(paramDecompressGzip, false, "decompress the gzip data of received messages")
+	configureBoolFlag(paramCompressGzip, false, "compress the data of forwarded messages with gzip")
+	configureIntFlag(paramMaxMessageBytes, defaultMaxMessageBytes, "size above which messages are dead-lettered or dropped instead of published, 0 for unlimited")
+	configureIntFlag(paramPublishConcurrency, 0, "maximum number of publishes awaited at once across mappings, independently of max-outstanding-messages, 0 for unlimited")
+	configureIntFlag(paramReceiveGoroutines, pubsub.DefaultReceiveSettings.NumGoroutines, "number of pull streams of each subscription, max-outstanding-messages still bounds the messages processed at once across all of them")
+	configureListFlag(paramInjectAttributes, "key=value attributes added to forwarded messages")
+	configureBoolFlag(paramSynchronousPull, false, "receive with unary pull requests, one at a time per subscription, instead of streaming pulls, receive-goroutines being ignored")
+	configureBoolFlag(paramInjectForwardedTimestamp, false, "add the RFC3339 forwarding time to forwarded messages as the forwarded-at attribute")
+	configureBoolFlag(paramPreservePublishTime, false, "add the RFC3339 publish time of the received message to forwarded messages as the publish-time-attribute attribute")
+	configureFlag(paramPublishTimeAttribute, defaultPublishTimeAttribute, "attribute holding the original publish time with preserve-publish-time")
+	configureFlag(paramFlowControlBehavior, defaultFlowControlBehavior, "behavior of the subscriptions when max-outstanding-messages or max-outstanding-bytes is reached, block, ignore or signal-error")
+	configureBoolFlag(paramStampSequence, false, "add the rank of each publish of the process to forwarded messages as the forward_seq attribute")
+	configureFlag(paramAckMode, defaultAckMode, "when to ack messages: on-success of the publish, before-publish (at-most-once) or always")
+	configureBoolFlag(paramValidateSchema, false, "validate the forwarded data against the schema file, dead-lettering or dropping invalid messages")
+	configureFlag(paramSchemaFile, "", "protobuf (.proto) or Avro schema file of the destination topic")
+	configureFlag(paramSchemaEncoding, defaultSchemaEncoding, "encoding of the validated data, json or binary")
+	configureFloatFlag(paramMaxPublishRate, 0, "maximum number of publishes per second across mappings, 0 for unlimited")
+	configureIntFlag(paramPublishBurst, defaultPublishBurst, "number of publishes allowed at once above max-publish-rate")
+	configureDurationFlag(paramDedupWindow, 0, "drop messages already forwarded within this duration, best-effort and in memory, 0 to disable")
+	configureIntFlag(paramDedupSize, defaultDedupSize, "maximum number of message keys remembered for deduplication")
+	configureFlag(paramDedupAttribute, "", "attribute holding the deduplication key, the message ID when empty")
+	configureDurationFlag(paramPublishTimeout, defaultPublishTimeout, "maximum wait for the server to confirm each publish attempt, the message being nacked after it, 0 for unlimited")
+	configureFlag(paramErrorLogSample, "", "sample the per-message error logs as first:every, e.g. 10:100 logs the first 10 errors of each minute then 1 in 100")
+	configureFlag(paramInputCodec, "", "codec decoding the received data, json or avro, to transcode it with output-codec")
+	configureFlag(paramOutputCodec, "", "codec encoding the forwarded data, json or avro")
+	configureFlag(paramCodecSchemaFile, "", "Avro schema file of the avro codec")
+	configureFlag(paramEnvelopeTemplate, "", "Go template producing the forwarded data from the message ID, Data, Text, Attributes, OrderingKey and PublishTime, the data being forwarded as is when empty")
+	configureFlag(paramAdminAddr, "", "address (host:port) serving the /pause, /resume and /status admin endpoints, disabled when empty")
+	configureFlag(paramAdminToken, "", "bearer token required by the admin endpoints")
+	configureFlag(paramAdminTLSCert, "", "PEM certificate file the metrics, health and admin endpoints are served with over https, with admin-tls-key")
+	configureFlag(paramAdminTLSKey, "", "PEM private key file of admin-tls-cert")
+	configureFlag(paramBigQueryProject, "", "project of the bigquery table when destination-type is bigquery, the destination project when empty")
+	configureFlag(paramBigQueryDataset, "", "dataset of the bigquery table when destination-type is bigquery")
+	configureFlag(paramBigQueryTable, "", "bigquery table the JSON data of messages is inserted to when destination-type is bigquery")
+	configureDurationFlag(paramBigQueryFlushInterval, defaultBigQueryFlushInterval, "maximum delay before the pending rows are inserted to the bigquery table")
+	configureDurationFlag(paramRunDuration, 0, "stop forwarding and exit after this duration, e.g. for drain jobs, 0 to run until stopped")
+	configureFlag(paramFromCredentialsKMSKey, "", "Cloud KMS key (projects/.../cryptoKeys/...) the source credentials are encrypted with, the JSON credentials being base64 encoded")
+	configureFlag(paramToCredentialsKMSKey, "", "Cloud KMS key the destination credentials are encrypted with, the JSON credentials being base64 encoded")
+	configureDurationFlag(paramMaxMessageAgeWarn, 0, "log a warning for received messages published longer than this ago, 0 to never warn")
+	configureIntFlag(paramRedeliveryTrackSize, defaultRedeliveryTrackSize, "maximum number of message IDs remembered to detect redeliveries, 0 to disable")
+	configureDurationFlag(paramRedeliveryWarn, 0, "log a warning for messages redelivered longer than this after their first reception, 0 to never warn")
+	configureListFlag(paramRequireAttributes, "attributes messages must have to be forwarded, others being dead-lettered or dropped")
+	configureDurationFlag(paramGRPCKeepaliveTime, 0, "interval of the grpc keepalive pings of idle connections, at least 30s, 0 for the client default of 5m")
+	configureDurationFlag(paramGRPCKeepaliveTimeout, 0, "wait for a keepalive ping ack before closing the connection, 0 for the grpc default of 20s")
+	configureIntFlag(paramGRPCConnectionPool, 0, "number of grpc connections of each pubsub client, 0 for the client default of the number of CPUs up to 4")
+	configureDurationFlag(paramDrainIdle, 0, "stop forwarding and exit once no message was received for this duration, e.g. to drain a subscription, 0 to run until stopped")
+	configureFlag(paramOrderingKeyAttribute, "", "attribute giving the ordering key of forwarded messages instead of the received key, messages without it being published unordered")
+	configureIntFlag(paramMaxMessages, 0, "stop forwarding and exit once this number of messages was forwarded, e.g. for batch runs, 0 to run until stopped")
+	configureBoolFlag(paramIgnoreOrdering, false, "publish messages without ordering key, whatever the received key, for the publishes to run in parallel")
+	configureIntFlag(paramMaxBytes, 0, "stop forwarding and exit once this number of bytes of message data was forwarded, 0 to run until stopped")
+	configureIntFlag(paramCircuitFailureThreshold, 0, "consecutive publish failures opening the circuit breaker of a mapping, messages then being nacked, 0 to disable it")
+	configureDurationFlag(paramCircuitResetTimeout, defaultCircuitResetTimeout, "time the circuit breaker stays open before probing the destination with a single message")
+	configureFlag(paramDestinationURL, "", "URL messages are posted to when destination-type is http")
+	configureDurationFlag(paramDestinationTimeout, defaultDestinationTimeout, "timeout of each request to the http destination")
+	configureFlag(paramDestinationToken, "", "bearer token sent in the Authorization header of the requests to the http destination")
+	configureListFlag(paramKafkaBrokers, "comma separated list of the host:port of the kafka brokers when destination-type is kafka")
+	configureFlag(paramKafkaTopic, "", "kafka topic messages are produced to, the destination topics of the mappings when empty")
+	configureFlag(paramKafkaKeyAttribute, "", "message attribute giving the key of kafka records, the ordering key when empty")
+	configureFlag(paramKafkaSASLMechanism, "", "SASL mechanism authenticating to the kafka brokers, plain, scram-sha-256 or scram-sha-512, none when empty")
+	configureFlag(paramKafkaSASLUsername, "", "SASL username of the kafka brokers")
+	configureFlag(paramKafkaSASLPassword, "", "SASL password of the kafka brokers")
+	configureBoolFlag(paramKafkaTLS, false, "connect to the kafka brokers with TLS")
+	configureFlag(paramKafkaCACertFile, "", "path of a PEM CA bundle trusted to verify the kafka brokers, the system roots when empty")
+	configureBoolFlag(paramListAvailable, false, "list the subscriptions or topics of the project when a subscription or destination topic does not exist")
+	configureFlag(paramFromCredentialsSecret, "", "Secret Manager secret version (projects/.../secrets/.../versions/...) holding the source JSON credentials")
+	configureFlag(paramToCredentialsSecret, "", "Secret Manager secret version holding the destination JSON credentials")
+	configureIntFlag(paramMaxInflightPerKey, 0, "maximum number of publishes awaited at once per ordering key of each mapping, receiving being delayed beyond, 0 for unlimited")
+	configureDurationFlag(paramBacklogLogInterval, 0, "interval at which the backlog of the subscriptions is queried from Cloud Monitoring and logged, 0 to never log it")
+	configureDurationFlag(paramNackDelay, 0, "delay before nacking a message that could not be forwarded, spacing out its redeliveries, 0 to nack right away")
+	configureDurationFlag(paramShutdownTimeout, defaultShutdownTimeout, "maximum time to wait for in-flight messages on shutdown")
 }
 
 func configureFlag(flagName, defaultValue, usage string) {
@@ -158,22 +618,305 @@ func configureFlag(flagName, defaultValue, usage string) {
 	_ = viper.BindPFlag(flagName, RootCmd.PersistentFlags().Lookup(flagName))
 }
 
+func configureBoolFlag(flagName string, defaultValue bool, usage string) {
+	RootCmd.PersistentFlags().Bool(flagName, defaultValue, usage)
+	_ = viper.BindPFlag(flagName, RootCmd.PersistentFlags().Lookup(flagName))
+}
+
+func configureIntFlag(flagName string, defaultValue int, usage string) {
+	RootCmd.PersistentFlags().Int(flagName, defaultValue, usage)
+	_ = viper.BindPFlag(flagName, RootCmd.PersistentFlags().Lookup(flagName))
+}
+
+func configureFloatFlag(flagName string, defaultValue float64, usage string) {
+	RootCmd.PersistentFlags().Float64(flagName, defaultValue, usage)
+	_ = viper.BindPFlag(flagName, RootCmd.PersistentFlags().Lookup(flagName))
+}
+
+func configureDurationFlag(flagName string, defaultValue time.Duration, usage string) {
+	RootCmd.PersistentFlags().Duration(flagName, defaultValue, usage)
+	_ = viper.BindPFlag(flagName, RootCmd.PersistentFlags().Lookup(flagName))
+}
+
+func configureListFlag(flagName, usage string) {
+	RootCmd.PersistentFlags().StringSlice(flagName, nil, usage)
+	_ = viper.BindPFlag(flagName, RootCmd.PersistentFlags().Lookup(flagName))
+}
+
+// getList returns a list value, splitting comma separated values coming from
+// environment variables or config files.
+func getList(key string) []string {
+	var values []string
+	for _, v := range viper.GetStringSlice(key) {
+		for _, item := range strings.Split(v, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				values = append(values, item)
+			}
+		}
+	}
+	return values
+}
+
+// overlayFile returns the overlay of configFile, the last config file, for
+// env, config.<env>.yaml next to it, or in the working directory when no
+// config file is set
+func overlayFile(configFile, env string) string {
+	if configFile == "" {
+		return "config." + env + ".yaml"
+	}
+	ext := filepath.Ext(configFile)
+	return strings.TrimSuffix(configFile, ext) + "." + env + ext
+}
+
+// configFormats are the supported formats of the config files
+var configFormats = []string{"yaml", "json", "toml"}
+
+func isConfigFormat(format string) bool {
+	for _, f := range configFormats {
+		if f == format {
+			return true
+		}
+	}
+	return false
+}
+
 // initConfig reads in config file and ENV variables if set.
 func initConfig() {
 	viper.SetEnvKeyReplacer(strings.NewReplacer("-", "_"))
 	viper.AutomaticEnv()
-	viper.SetConfigFile(viper.GetString(paramConfig))
-	// If a config file is found, read it in.
-	if err := viper.ReadInConfig(); err == nil {
-		logrus.Infof("Using config file: %s", viper.ConfigFileUsed())
+	configFiles := getList(paramConfig)
+	// files without a recognizable extension need their format
+	if format := viper.GetString(paramConfigFormat); format != "" {
+		if !isConfigFormat(format) {
+			logrus.Errorf("CONFIG_FORMAT must be one of %s, got %q.", strings.Join(configFormats, ", "), format)
+			os.Exit(exitCodeConfig)
+		}
+		viper.SetConfigType(format)
+	}
+	// config files are merged in order, the values of later files winning
+	// over the earlier ones
+	for _, configFile := range configFiles {
+		viper.SetConfigFile(configFile)
+		if err := viper.MergeInConfig(); err != nil {
+			logrus.Errorf("Could not read config file %s: %v", configFile, err)
+			os.Exit(exitCodeConfig)
+		}
+		if !viper.GetBool(paramQuiet) {
+			logrus.Infof("Using config file: %s", configFile)
+		}
+	}
+	var configFile string
+	if len(configFiles) > 0 {
+		configFile = configFiles[len(configFiles)-1]
+	}
+	// values of the environment overlay win over the config files ones, flags
+	// and environment variables still win over both
+	if env := viper.GetString(paramEnv); env != "" {
+		overlay := overlayFile(configFile, env)
+		viper.SetConfigFile(overlay)
+		if err := viper.MergeInConfig(); err != nil {
+			logrus.Errorf("Could not read config overlay %s: %v", overlay, err)
+			os.Exit(exitCodeConfig)
+		}
+		if !viper.GetBool(paramQuiet) {
+			logrus.Infof("Using config overlay: %s", overlay)
+		}
 	}
 
 	cfg.LogFormat = viper.GetString(paramLogFormat)
+	cfg.LogOutput = viper.GetString(paramLogOutput)
+	cfg.LogFields = getList(paramLogFields)
+	cfg.LogTimestampFormat = viper.GetString(paramLogTimestampFormat)
+	cfg.LogSink = viper.GetString(paramLogSink)
+	cfg.LogProject = viper.GetString(paramLogProject)
+	cfg.LogName = viper.GetString(paramLogName)
+	cfg.LogResourceType = viper.GetString(paramLogResourceType)
+	cfg.LogResourceLabels = getList(paramLogResourceLabels)
 	cfg.LogLevel = viper.GetString(paramLogLevel)
+	cfg.Quiet = viper.GetBool(paramQuiet)
 	cfg.FromGoogleCloudProject = viper.GetString(paramFromGoogleCloudProject)
 	cfg.ToGoogleCloudProject = viper.GetString(paramToGoogleCloudProject)
 	cfg.FromGoogleApplicationCredentials = viper.GetString(paramFromGoogleApplicationCredentials)
 	cfg.ToGoogleApplicationCredentials = viper.GetString(paramToGoogleApplicationCredentials)
+	cfg.FromGoogleApplicationCredentialsFile = viper.GetString(paramFromGoogleApplicationCredentialsFile)
+	cfg.ToGoogleApplicationCredentialsFile = viper.GetString(paramToGoogleApplicationCredentialsFile)
 	cfg.PubSubSubscription = viper.GetString(paramPubSubSubscription)
-	cfg.PubSubDestinationTopic = viper.GetString(paramPubSubDestinationTopic)
+	cfg.PubSubDestinationTopic = strings.Join(getList(paramPubSubDestinationTopic), ",")
+	cfg.ShutdownTimeout = viper.GetDuration(paramShutdownTimeout)
+	cfg.MetricsAddr = viper.GetString(paramMetricsAddr)
+	cfg.HealthAddr = viper.GetString(paramHealthAddr)
+	cfg.TransformCEL = viper.GetString(paramTransformCEL)
+	cfg.DryRun = viper.GetBool(paramDryRun)
+	cfg.DryRunAck = viper.GetBool(paramDryRunAck)
+	cfg.DestinationType = viper.GetString(paramDestinationType)
+	cfg.PubSubLiteLocation = viper.GetString(paramPubSubLiteLocation)
+	cfg.EmulatorHost = viper.GetString(paramEmulatorHost)
+	cfg.FilterAttribute = viper.GetString(paramFilterAttribute)
+	cfg.FilterValues = getList(paramFilterValues)
+	cfg.FilterCaseInsensitive = viper.GetBool(paramFilterCaseInsensitive)
+	cfg.DataMatchRegex = viper.GetString(paramDataMatchRegex)
+	cfg.MinPublishTime = viper.GetString(paramMinPublishTime)
+	cfg.PanicFatal = viper.GetBool(paramPanicFatal)
+	cfg.SampleRate = viper.GetFloat64(paramSampleRate)
+	cfg.SampleDeterministic = viper.GetBool(paramSampleDeterministic)
+	cfg.SampleAttribute = viper.GetString(paramSampleAttribute)
+	cfg.AttributeAllowlist = getList(paramAttributeAllowlist)
+	cfg.AttributeBlocklist = getList(paramAttributeBlocklist)
+	cfg.AttributeMapping = getList(paramAttributeMapping)
+	cfg.MaxOutstandingMessages = viper.GetInt(paramMaxOutstandingMessages)
+	cfg.MaxOutstandingBytes = viper.GetInt(paramMaxOutstandingBytes)
+	cfg.DeadLetterTopic = viper.GetString(paramDeadLetterTopic)
+	cfg.MaxPublishRetries = viper.GetInt(paramMaxPublishRetries)
+	cfg.PublishMaxAttempts = viper.GetInt(paramPublishMaxAttempts)
+	cfg.PublishInitialBackoff = viper.GetDuration(paramPublishInitialBackoff)
+	cfg.PublishMaxBackoff = viper.GetDuration(paramPublishMaxBackoff)
+	cfg.PublishCountThreshold = viper.GetInt(paramPublishCountThreshold)
+	cfg.PublishByteThreshold = viper.GetInt(paramPublishByteThreshold)
+	cfg.PublishDelayThreshold = viper.GetDuration(paramPublishDelayThreshold)
+	cfg.PublishAsyncAck = viper.GetBool(paramPublishAsyncAck)
+	cfg.Endpoint = viper.GetString(paramEndpoint)
+	cfg.CACertFile = viper.GetString(paramCACertFile)
+	cfg.ClientCertFile = viper.GetString(paramClientCertFile)
+	cfg.ClientKeyFile = viper.GetString(paramClientKeyFile)
+	cfg.LogCaller = viper.GetBool(paramLogCaller)
+	cfg.Check = viper.GetBool(paramCheck)
+	cfg.DynamicTopicAttribute = viper.GetString(paramDynamicTopicAttribute)
+	cfg.MirrorTopic = viper.GetBool(paramMirrorTopic)
+	cfg.MirrorTopicPrefix = viper.GetString(paramMirrorTopicPrefix)
+	cfg.MirrorTopicSuffix = viper.GetString(paramMirrorTopicSuffix)
+	cfg.TopicTemplate = viper.GetString(paramTopicTemplate)
+	cfg.ReceiveMaxRetries = viper.GetInt(paramReceiveMaxRetries)
+	cfg.ReceiveBackoffMax = viper.GetDuration(paramReceiveBackoffMax)
+	cfg.ReceiveAuthRetries = viper.GetInt(paramReceiveAuthRetries)
+	cfg.FanOutMode = viper.GetString(paramFanOutMode)
+	cfg.OtelEndpoint = viper.GetString(paramOtelEndpoint)
+	cfg.OtelInsecure = viper.GetBool(paramOtelInsecure)
+	cfg.DestinationFile = viper.GetString(paramDestinationFile)
+	cfg.DestinationFileMaxBytes = viper.GetInt(paramDestinationFileMaxBytes)
+	cfg.DecompressGzip = viper.GetBool(paramDecompressGzip)
+	cfg.CompressGzip = viper.GetBool(paramCompressGzip)
+	cfg.Env = viper.GetString(paramEnv)
+	cfg.Version = Version
+	cfg.MaxMessageBytes = viper.GetInt(paramMaxMessageBytes)
+	cfg.PublishConcurrency = viper.GetInt(paramPublishConcurrency)
+	cfg.ReceiveGoroutines = viper.GetInt(paramReceiveGoroutines)
+	cfg.SynchronousPull = viper.GetBool(paramSynchronousPull)
+	cfg.InjectAttributes = getList(paramInjectAttributes)
+	cfg.InjectForwardedTimestamp = viper.GetBool(paramInjectForwardedTimestamp)
+	cfg.PreservePublishTime = viper.GetBool(paramPreservePublishTime)
+	cfg.PublishTimeAttribute = viper.GetString(paramPublishTimeAttribute)
+	cfg.StampSequence = viper.GetBool(paramStampSequence)
+	cfg.FlowControlBehavior = viper.GetString(paramFlowControlBehavior)
+	cfg.AckMode = viper.GetString(paramAckMode)
+	cfg.ValidateSchema = viper.GetBool(paramValidateSchema)
+	cfg.SchemaFile = viper.GetString(paramSchemaFile)
+	cfg.SchemaEncoding = viper.GetString(paramSchemaEncoding)
+	cfg.MaxPublishRate = viper.GetFloat64(paramMaxPublishRate)
+	cfg.PublishBurst = viper.GetInt(paramPublishBurst)
+	cfg.DedupWindow = viper.GetDuration(paramDedupWindow)
+	cfg.DedupSize = viper.GetInt(paramDedupSize)
+	cfg.DedupAttribute = viper.GetString(paramDedupAttribute)
+	cfg.PublishTimeout = viper.GetDuration(paramPublishTimeout)
+	cfg.ErrorLogSample = viper.GetString(paramErrorLogSample)
+	cfg.InputCodec = viper.GetString(paramInputCodec)
+	cfg.OutputCodec = viper.GetString(paramOutputCodec)
+	cfg.CodecSchemaFile = viper.GetString(paramCodecSchemaFile)
+	cfg.AdminAddr = viper.GetString(paramAdminAddr)
+	cfg.EnvelopeTemplate = viper.GetString(paramEnvelopeTemplate)
+	cfg.AdminToken = viper.GetString(paramAdminToken)
+	cfg.AdminTLSCert = viper.GetString(paramAdminTLSCert)
+	cfg.AdminTLSKey = viper.GetString(paramAdminTLSKey)
+	cfg.BigQueryProject = viper.GetString(paramBigQueryProject)
+	cfg.BigQueryDataset = viper.GetString(paramBigQueryDataset)
+	cfg.BigQueryTable = viper.GetString(paramBigQueryTable)
+	cfg.BigQueryFlushInterval = viper.GetDuration(paramBigQueryFlushInterval)
+	cfg.RunDuration = viper.GetDuration(paramRunDuration)
+	cfg.FromCredentialsKMSKey = viper.GetString(paramFromCredentialsKMSKey)
+	cfg.ToCredentialsKMSKey = viper.GetString(paramToCredentialsKMSKey)
+	cfg.MaxMessageAgeWarn = viper.GetDuration(paramMaxMessageAgeWarn)
+	cfg.RedeliveryTrackSize = viper.GetInt(paramRedeliveryTrackSize)
+	cfg.RedeliveryWarn = viper.GetDuration(paramRedeliveryWarn)
+	cfg.RequireAttributes = getList(paramRequireAttributes)
+	cfg.GRPCKeepaliveTime = viper.GetDuration(paramGRPCKeepaliveTime)
+	cfg.GRPCKeepaliveTimeout = viper.GetDuration(paramGRPCKeepaliveTimeout)
+	cfg.GRPCConnectionPool = viper.GetInt(paramGRPCConnectionPool)
+	cfg.DrainIdle = viper.GetDuration(paramDrainIdle)
+	cfg.MaxMessages = viper.GetInt(paramMaxMessages)
+	cfg.MaxBytes = viper.GetInt(paramMaxBytes)
+	cfg.OrderingKeyAttribute = viper.GetString(paramOrderingKeyAttribute)
+	cfg.IgnoreOrdering = viper.GetBool(paramIgnoreOrdering)
+	cfg.CircuitFailureThreshold = viper.GetInt(paramCircuitFailureThreshold)
+	cfg.CircuitResetTimeout = viper.GetDuration(paramCircuitResetTimeout)
+	cfg.DestinationURL = viper.GetString(paramDestinationURL)
+	cfg.DestinationTimeout = viper.GetDuration(paramDestinationTimeout)
+	cfg.DestinationToken = viper.GetString(paramDestinationToken)
+	cfg.KafkaBrokers = getList(paramKafkaBrokers)
+	cfg.KafkaTopic = viper.GetString(paramKafkaTopic)
+	cfg.KafkaKeyAttribute = viper.GetString(paramKafkaKeyAttribute)
+	cfg.KafkaSASLMechanism = viper.GetString(paramKafkaSASLMechanism)
+	cfg.KafkaSASLUsername = viper.GetString(paramKafkaSASLUsername)
+	cfg.KafkaSASLPassword = viper.GetString(paramKafkaSASLPassword)
+	cfg.KafkaTLS = viper.GetBool(paramKafkaTLS)
+	cfg.KafkaCACertFile = viper.GetString(paramKafkaCACertFile)
+	cfg.ListAvailable = viper.GetBool(paramListAvailable)
+	cfg.FromCredentialsSecret = viper.GetString(paramFromCredentialsSecret)
+	cfg.ToCredentialsSecret = viper.GetString(paramToCredentialsSecret)
+	cfg.MaxInflightPerKey = viper.GetInt(paramMaxInflightPerKey)
+	cfg.BacklogLogInterval = viper.GetDuration(paramBacklogLogInterval)
+	cfg.NackDelay = viper.GetDuration(paramNackDelay)
+
+	if cfg.EmulatorHost == "" {
+		cfg.EmulatorHost = os.Getenv(forwarder.EmulatorHostEnv)
+	}
+
+	if err := viper.UnmarshalKey(paramMappings, &cfg.Mappings); err != nil {
+		logrus.Errorf("mappings are not ok, ignoring them : %v", err)
+		cfg.Mappings = nil
+	}
+	if err := viper.UnmarshalKey(paramPublishProfiles, &cfg.PublishProfiles); err != nil {
+		logrus.Errorf("publish profiles are not ok, ignoring them : %v", err)
+		cfg.PublishProfiles = nil
+	}
+	// single subscription/topic flags act as a one-element mapping
+	if cfg.PubSubSubscription != "" || cfg.PubSubDestinationTopic != "" {
+		cfg.Mappings = append(cfg.Mappings, forwarder.Mapping{
+			PubSubSubscription:     cfg.PubSubSubscription,
+			PubSubDestinationTopic: cfg.PubSubDestinationTopic,
+		})
+	}
+	for i := range cfg.Mappings {
+		if cfg.Mappings[i].FromGoogleCloudProject == "" {
+			cfg.Mappings[i].FromGoogleCloudProject = cfg.FromGoogleCloudProject
+		}
+		if cfg.Mappings[i].ToGoogleCloudProject == "" {
+			cfg.Mappings[i].ToGoogleCloudProject = cfg.ToGoogleCloudProject
+		}
+	}
+}
+
+// exitOnProblems prints every problem and exits with code when there is any
+func exitOnProblems(problems []string, code int) {
+	if len(problems) == 0 {
+		return
+	}
+	for _, p := range problems {
+		_, _ = fmt.Fprintln(os.Stderr, p)
+	}
+	os.Exit(code)
+}
+
+// redactCredentials returns a loggable summary of JSON credentials, holding
+// only the service account email and project, never the private key
+func redactCredentials(creds string) string {
+	if creds == "" {
+		return ""
+	}
+	var account struct {
+		ClientEmail string `json:"client_email"`
+		ProjectID   string `json:"project_id"`
+	}
+	if err := json.Unmarshal([]byte(creds), &account); err != nil {
+		return "redacted, not valid JSON"
+	}
+	return fmt.Sprintf("redacted (client_email=%s, project_id=%s)", account.ClientEmail, account.ProjectID)
 }
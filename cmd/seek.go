@@ -0,0 +1,115 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"cloud.google.com/go/pubsub"
+	"github.com/karnott/pubsub-to-pubsub/forwarder"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+const (
+	// param names
+	paramSeekTime     = "seek-time"
+	paramSeekSnapshot = "seek-snapshot"
+)
+
+// seekCmd seeks the subscriptions of the mappings to a point in time or to a
+// snapshot, so that their messages are delivered again
+var seekCmd = &cobra.Command{
+	Use:   "seek",
+	Short: "Seek the subscriptions to a timestamp or a snapshot to replay messages",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		ctx := context.Background()
+
+		seekTime := viper.GetString(paramSeekTime)
+		snapshot := viper.GetString(paramSeekSnapshot)
+
+		problems := cfg.ValidateMappings()
+		var at time.Time
+		switch {
+		case seekTime != "" && snapshot != "":
+			problems = append(problems, "SEEK_TIME and SEEK_SNAPSHOT can not be both set.")
+		case seekTime != "":
+			t, err := time.Parse(time.RFC3339, seekTime)
+			if err != nil {
+				problems = append(problems, fmt.Sprintf("SEEK_TIME must be a RFC3339 timestamp, got %q.", seekTime))
+			}
+			at = t
+		case snapshot == "":
+			problems = append(problems, "SEEK_TIME or SEEK_SNAPSHOT variable must be set.")
+		}
+		exitOnProblems(problems, exitCodeConfig)
+
+		fromClients, _, err := forwarder.NewClientPools(ctx, cfg.Config)
+		if err != nil {
+			return fmt.Errorf("could not create pubsub clients: %w", err)
+		}
+		defer fromClients.Close()
+
+		failed := 0
+		for _, m := range cfg.Mappings {
+			log := logrus.WithField(paramPubSubSubscription, m.PubSubSubscription)
+
+			client, err := fromClients.Get(ctx, m.SourceProject())
+			if err != nil {
+				return &forwarder.Error{Kind: forwarder.KindConnection, Err: fmt.Errorf("could not create pubsub client for %s %s: %w", paramFromGoogleCloudProject, m.SourceProject(), err)}
+			}
+
+			if err := seekSubscription(ctx, log, client, m, at, snapshot); err != nil {
+				log.Errorf("err when seeking subscription: %v", err)
+				failed++
+			}
+		}
+
+		if failed > 0 {
+			return fmt.Errorf("%d of %d subscriptions could not be seeked", failed, len(cfg.Mappings))
+		}
+		logrus.Info("Seek complete")
+		return nil
+	},
+}
+
+// seekSubscription seeks the subscription of m to the snapshot when it is
+// set, to at otherwise, after checking that the subscription exists
+func seekSubscription(ctx context.Context, log *logrus.Entry, client *pubsub.Client, m forwarder.Mapping, at time.Time, snapshot string) error {
+	sub := forwarder.SubscriptionIn(client, m.PubSubSubscription)
+	config, err := sub.Config(ctx)
+	if err != nil {
+		return fmt.Errorf("subscription %s of project %s: %w", m.PubSubSubscription, m.SourceProject(), err)
+	}
+
+	if snapshot != "" {
+		if err := sub.SeekToSnapshot(ctx, client.Snapshot(snapshot)); err != nil {
+			return err
+		}
+		log.Infof("Subscription seeked to snapshot %s", snapshot)
+		return nil
+	}
+
+	// messages are only kept for the retention duration, and acked ones only
+	// when the subscription retains them
+	if oldest := time.Now().Add(-config.RetentionDuration); config.RetentionDuration > 0 && at.Before(oldest) {
+		log.Warnf("Seek time is before the %s retention window of the subscription, messages published before %s are not retained", config.RetentionDuration, oldest.Format(time.RFC3339))
+	}
+	if !config.RetainAckedMessages {
+		log.Warn("Subscription does not retain acked messages, only unacked messages published after the seek time are delivered again")
+	}
+	if err := sub.SeekToTime(ctx, at); err != nil {
+		return err
+	}
+	log.Infof("Subscription seeked to %s", at.Format(time.RFC3339))
+	return nil
+}
+
+func init() {
+	seekCmd.Flags().String(paramSeekTime, "", "RFC3339 timestamp to seek the subscriptions to")
+	seekCmd.Flags().String(paramSeekSnapshot, "", "name of the snapshot, in the source project, to seek the subscriptions to")
+	_ = viper.BindPFlags(seekCmd.Flags())
+
+	RootCmd.AddCommand(seekCmd)
+}
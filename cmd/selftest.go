@@ -0,0 +1,187 @@
+package cmd
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"sync"
+	"time"
+
+	"cloud.google.com/go/pubsub"
+	"github.com/karnott/pubsub-to-pubsub/forwarder"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+const (
+	// param names
+	paramSelftestSubscription = "selftest-subscription"
+	paramSelftestTimeout      = "selftest-timeout"
+
+	// default parameters values
+	defaultSelftestTimeout = 30 * time.Second
+
+	// selftestAttribute is the attribute holding the unique tag of the test
+	// messages, for consumers to skip them
+	selftestAttribute = "selftest-id"
+)
+
+// selftestCmd checks the source subscriptions with the source credentials
+// and publishes a tagged message to the destination topics with the
+// destination credentials, optionally receiving it back from a test
+// subscription
+var selftestCmd = &cobra.Command{
+	Use:   "selftest",
+	Short: "Check connectivity and permissions by round-tripping a tagged message through the destination topics",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		ctx := context.Background()
+
+		testSubscription := viper.GetString(paramSelftestSubscription)
+		timeout := viper.GetDuration(paramSelftestTimeout)
+
+		problems := cfg.ValidateMappings()
+		if timeout <= 0 {
+			problems = append(problems, fmt.Sprintf("SELFTEST_TIMEOUT must be positive, got %s.", timeout))
+		}
+		exitOnProblems(problems, exitCodeConfig)
+
+		fromClients, toClients, err := forwarder.NewClientPools(ctx, cfg.Config)
+		if err != nil {
+			return fmt.Errorf("could not create pubsub clients: %w", err)
+		}
+		defer fromClients.Close()
+		defer toClients.Close()
+
+		failed := 0
+		for _, m := range cfg.Mappings {
+			log := logrus.
+				WithField(paramPubSubSubscription, m.PubSubSubscription).
+				WithField(paramPubSubDestinationTopic, m.PubSubDestinationTopic)
+
+			fromClient, err := fromClients.Get(ctx, m.SourceProject())
+			if err != nil {
+				return &forwarder.Error{Kind: forwarder.KindConnection, Err: fmt.Errorf("could not create pubsub client for %s %s: %w", paramFromGoogleCloudProject, m.SourceProject(), err)}
+			}
+			toClient, err := toClients.Get(ctx, m.DestinationProject())
+			if err != nil {
+				return &forwarder.Error{Kind: forwarder.KindConnection, Err: fmt.Errorf("could not create pubsub client for %s %s: %w", paramToGoogleCloudProject, m.DestinationProject(), err)}
+			}
+
+			start := time.Now()
+			if err := checkSubscription(ctx, fromClient, m.PubSubSubscription, timeout); err != nil {
+				log.Errorf("Self-test failed on the source subscription: %v", err)
+				failed++
+				continue
+			}
+			log.WithField("latency", time.Since(start)).Info("Source subscription reachable")
+
+			if cfg.DestinationType != forwarder.DestinationTypePubSub {
+				log.Warnf("Publish test skipped for %s destinations", cfg.DestinationType)
+				continue
+			}
+			if m.PubSubDestinationTopic == "" {
+				log.Warn("Publish test skipped for dynamically routed messages")
+				continue
+			}
+			for _, name := range m.DestinationTopics() {
+				if err := roundTrip(ctx, log.WithField("topic", name), toClient, name, testSubscription, timeout); err != nil {
+					log.Errorf("Self-test failed on destination topic %s: %v", name, err)
+					failed++
+				}
+			}
+		}
+
+		if failed > 0 {
+			return fmt.Errorf("self-test failed for %d subscriptions or topics", failed)
+		}
+		logrus.Info("Self-test passed")
+		return nil
+	},
+}
+
+// checkSubscription checks that the subscription can be read with client
+func checkSubscription(ctx context.Context, client *pubsub.Client, name string, timeout time.Duration) error {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	exists, err := forwarder.SubscriptionIn(client, name).Exists(ctx)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return fmt.Errorf("subscription %s does not exist", name)
+	}
+	return nil
+}
+
+// roundTrip publishes a tagged message to the topic and, when
+// testSubscription is set, waits for it to be received from that
+// subscription of the topic
+func roundTrip(ctx context.Context, log *logrus.Entry, client *pubsub.Client, topic, testSubscription string, timeout time.Duration) error {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	tag, err := selftestTag()
+	if err != nil {
+		return err
+	}
+	t := forwarder.TopicIn(client, topic)
+	defer t.Stop()
+
+	start := time.Now()
+	if _, err := t.Publish(ctx, &pubsub.Message{
+		Data:       []byte("pubsub-to-pubsub self-test"),
+		Attributes: map[string]string{selftestAttribute: tag},
+	}).Get(ctx); err != nil {
+		return fmt.Errorf("could not publish: %w", err)
+	}
+	published := time.Since(start)
+	log = log.WithField(selftestAttribute, tag)
+	log.WithField("latency", published).Info("Test message published")
+
+	if testSubscription == "" {
+		return nil
+	}
+	received := make(chan struct{})
+	var once sync.Once
+	rctx, stop := context.WithCancel(ctx)
+	defer stop()
+	err = forwarder.SubscriptionIn(client, testSubscription).Receive(rctx, func(_ context.Context, msg *pubsub.Message) {
+		if msg.Attributes[selftestAttribute] != tag {
+			// left for the other consumers of the test subscription
+			msg.Nack()
+			return
+		}
+		msg.Ack()
+		once.Do(func() { close(received) })
+		stop()
+	})
+	select {
+	case <-received:
+	default:
+		if err != nil {
+			return fmt.Errorf("could not receive from test subscription %s: %w", testSubscription, err)
+		}
+		return fmt.Errorf("test message not received from subscription %s within %s", testSubscription, timeout)
+	}
+	log.WithField("latency", time.Since(start)).Infof("Test message received from subscription %s", testSubscription)
+	return nil
+}
+
+// selftestTag returns a random tag identifying a test message
+func selftestTag() (string, error) {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+func init() {
+	selftestCmd.Flags().String(paramSelftestSubscription, "", "subscription to the destination topic, in the destination project, the test message is received from, the message is only published when empty")
+	selftestCmd.Flags().Duration(paramSelftestTimeout, defaultSelftestTimeout, "timeout of each check of the self-test")
+	_ = viper.BindPFlags(selftestCmd.Flags())
+
+	RootCmd.AddCommand(selftestCmd)
+}
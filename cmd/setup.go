@@ -0,0 +1,228 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"cloud.google.com/go/pubsub"
+	"github.com/karnott/pubsub-to-pubsub/forwarder"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+const (
+	// param names
+	paramCreateIfMissing   = "create-if-missing"
+	paramPubSubSourceTopic = "pubsub-source-topic"
+	paramAckDeadline       = "ack-deadline"
+	paramCreateAckDeadline = "create-ack-deadline"
+	paramCreateRetention   = "create-retention"
+	paramCreateExpiration  = "create-expiration"
+
+	// default parameters values
+	defaultAckDeadline = 10 * time.Second
+
+	// expirationNever is the create-expiration value of subscriptions that
+	// never expire
+	expirationNever = "never"
+
+	// limits enforced by pubsub
+	minAckDeadline = 10 * time.Second
+	maxAckDeadline = 600 * time.Second
+	minRetention   = 10 * time.Minute
+	maxRetention   = 7 * 24 * time.Hour
+	minExpiration  = 24 * time.Hour
+)
+
+// subscriptionSettings are the settings of the created subscriptions, zero
+// values keeping the pubsub defaults
+type subscriptionSettings struct {
+	ackDeadline time.Duration
+	retention   time.Duration
+	// expiration is nil for the default of 31 days and 0 to never expire
+	expiration *time.Duration
+}
+
+// setupCmd checks, and optionally creates, the subscriptions and topics of the mappings
+var setupCmd = &cobra.Command{
+	Use:   "setup",
+	Short: "Check that subscriptions and destination topics exist, optionally creating them",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		ctx := context.Background()
+
+		create := viper.GetBool(paramCreateIfMissing)
+		sourceTopic := viper.GetString(paramPubSubSourceTopic)
+		settings := subscriptionSettings{
+			ackDeadline: viper.GetDuration(paramCreateAckDeadline),
+			retention:   viper.GetDuration(paramCreateRetention),
+		}
+		// ack-deadline is the former name of create-ack-deadline
+		if cmd.Flags().Changed(paramAckDeadline) {
+			settings.ackDeadline = viper.GetDuration(paramAckDeadline)
+		}
+
+		problems := cfg.ValidateMappings()
+		if settings.ackDeadline < minAckDeadline || settings.ackDeadline > maxAckDeadline {
+			problems = append(problems, fmt.Sprintf("CREATE_ACK_DEADLINE must be between %s and %s, got %s.", minAckDeadline, maxAckDeadline, settings.ackDeadline))
+		}
+		if r := settings.retention; r != 0 && (r < minRetention || r > maxRetention) {
+			problems = append(problems, fmt.Sprintf("CREATE_RETENTION must be between %s and %s or 0 for the pubsub default, got %s.", minRetention, maxRetention, r))
+		}
+		if expiration, err := parseExpiration(viper.GetString(paramCreateExpiration)); err != nil {
+			problems = append(problems, fmt.Sprintf("CREATE_EXPIRATION must be %s or a duration of at least %s, got %q.", expirationNever, minExpiration, viper.GetString(paramCreateExpiration)))
+		} else {
+			settings.expiration = expiration
+		}
+		exitOnProblems(problems, exitCodeConfig)
+
+		fromClients, toClients, err := forwarder.NewClientPools(ctx, cfg.Config)
+		if err != nil {
+			return fmt.Errorf("could not create pubsub clients: %w", err)
+		}
+		defer fromClients.Close()
+		defer toClients.Close()
+
+		failed := 0
+		for _, m := range cfg.Mappings {
+			log := logrus.
+				WithField(paramPubSubSubscription, m.PubSubSubscription).
+				WithField(paramPubSubDestinationTopic, m.PubSubDestinationTopic)
+
+			fromClient, err := fromClients.Get(ctx, m.SourceProject())
+			if err != nil {
+				return &forwarder.Error{Kind: forwarder.KindConnection, Err: fmt.Errorf("could not create pubsub client for %s %s: %w", paramFromGoogleCloudProject, m.SourceProject(), err)}
+			}
+			toClient, err := toClients.Get(ctx, m.DestinationProject())
+			if err != nil {
+				return &forwarder.Error{Kind: forwarder.KindConnection, Err: fmt.Errorf("could not create pubsub client for %s %s: %w", paramToGoogleCloudProject, m.DestinationProject(), err)}
+			}
+
+			if cfg.DestinationType != forwarder.DestinationTypePubSub {
+				log.Warnf("Destination topic check skipped for %s destinations", cfg.DestinationType)
+			} else if m.PubSubDestinationTopic == "" {
+				log.Warn("Destination topic check skipped for dynamically routed messages")
+			} else {
+				for _, name := range m.DestinationTopics() {
+					if err := setupTopic(ctx, toClient, m.DestinationProject(), name, create); err != nil {
+						log.Errorf("err when setting up destination topic %s: %v", name, err)
+						failed++
+					}
+				}
+			}
+
+			if m.PubSubSourceTopic == "" {
+				m.PubSubSourceTopic = sourceTopic
+			}
+			if err := setupSubscription(ctx, fromClient, m.SourceProject(), m, settings, create); err != nil {
+				log.Errorf("err when setting up subscription: %v", err)
+				failed++
+			}
+		}
+
+		if failed > 0 {
+			return fmt.Errorf("%d subscriptions or topics are missing or could not be created", failed)
+		}
+		logrus.Info("Setup complete")
+		return nil
+	},
+}
+
+// setupTopic checks that the topic exists in project, creating it when create is set
+func setupTopic(ctx context.Context, client *pubsub.Client, project, name string, create bool) error {
+	exists, err := forwarder.TopicIn(client, name).Exists(ctx)
+	if err != nil {
+		return err
+	}
+	if exists {
+		logrus.Infof("Topic %s exists in project %s", name, project)
+		return nil
+	}
+	if !create {
+		return fmt.Errorf("topic %s does not exist in project %s", name, project)
+	}
+	if isFullyQualified(name) {
+		return fmt.Errorf("topic %s does not exist, fully-qualified topics are not created", name)
+	}
+	if _, err := client.CreateTopic(ctx, name); err != nil {
+		return err
+	}
+	logrus.Infof("Topic %s created in project %s", name, project)
+	return nil
+}
+
+// setupSubscription checks that the subscription of m exists in project, creating it
+// on the mapping source topic with settings when create is set
+func setupSubscription(ctx context.Context, client *pubsub.Client, project string, m forwarder.Mapping, settings subscriptionSettings, create bool) error {
+	exists, err := forwarder.SubscriptionIn(client, m.PubSubSubscription).Exists(ctx)
+	if err != nil {
+		return err
+	}
+	if exists {
+		logrus.Infof("Subscription %s exists in project %s", m.PubSubSubscription, project)
+		return nil
+	}
+	if !create {
+		return fmt.Errorf("subscription %s does not exist in project %s", m.PubSubSubscription, project)
+	}
+	if isFullyQualified(m.PubSubSubscription) {
+		return fmt.Errorf("subscription %s does not exist, fully-qualified subscriptions are not created", m.PubSubSubscription)
+	}
+	if m.PubSubSourceTopic == "" {
+		return fmt.Errorf("subscription %s does not exist and %s is not set to create it", m.PubSubSubscription, paramPubSubSourceTopic)
+	}
+	subCfg := pubsub.SubscriptionConfig{
+		Topic:             client.Topic(m.PubSubSourceTopic),
+		AckDeadline:       settings.ackDeadline,
+		RetentionDuration: settings.retention,
+	}
+	if settings.expiration != nil {
+		subCfg.ExpirationPolicy = *settings.expiration
+	}
+	_, err = client.CreateSubscription(ctx, m.PubSubSubscription, subCfg)
+	if err != nil {
+		return err
+	}
+	logrus.Infof("Subscription %s created on topic %s in project %s", m.PubSubSubscription, m.PubSubSourceTopic, project)
+	return nil
+}
+
+// parseExpiration parses the create-expiration value, nil when it is empty
+func parseExpiration(value string) (*time.Duration, error) {
+	switch value {
+	case "":
+		return nil, nil
+	case expirationNever:
+		never := time.Duration(0)
+		return &never, nil
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		return nil, err
+	}
+	if d < minExpiration {
+		return nil, fmt.Errorf("expiration %s is shorter than %s", d, minExpiration)
+	}
+	return &d, nil
+}
+
+// isFullyQualified reports whether name is a projects/<project>/... resource
+// name, which can live in another project than the client one
+func isFullyQualified(name string) bool {
+	return strings.HasPrefix(name, "projects/")
+}
+
+func init() {
+	setupCmd.Flags().Bool(paramCreateIfMissing, false, "create the subscriptions and destination topics that do not exist")
+	setupCmd.Flags().String(paramPubSubSourceTopic, "", "google cloud topic, in the source project, of the subscriptions to create")
+	setupCmd.Flags().Duration(paramCreateAckDeadline, defaultAckDeadline, "ack deadline of the subscriptions to create, between 10s and 600s")
+	setupCmd.Flags().Duration(paramCreateRetention, 0, "message retention of the subscriptions to create, between 10m and 168h, 0 for the pubsub default of 7 days")
+	setupCmd.Flags().String(paramCreateExpiration, "", "inactivity period after which the subscriptions to create expire, at least 24h or never, empty for the pubsub default of 31 days")
+	setupCmd.Flags().Duration(paramAckDeadline, defaultAckDeadline, "ack deadline of the subscriptions to create")
+	_ = setupCmd.Flags().MarkDeprecated(paramAckDeadline, "use --"+paramCreateAckDeadline+" instead")
+	_ = viper.BindPFlags(setupCmd.Flags())
+
+	RootCmd.AddCommand(setupCmd)
+}
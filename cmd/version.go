@@ -0,0 +1,34 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+)
+
+// build metadata, injected at build time with
+// -ldflags "-X github.com/karnott/pubsub-to-pubsub/cmd.Version=..."
+var (
+	Version   = "dev"
+	GitCommit = "unknown"
+	BuildDate = "unknown"
+)
+
+// versionCmd prints the build metadata
+var versionCmd = &cobra.Command{
+	Use:   "version",
+	Short: "Print the version, git commit and build date",
+	Run: func(cmd *cobra.Command, args []string) {
+		fmt.Print(versionString())
+	},
+}
+
+func versionString() string {
+	return fmt.Sprintf("pubsub-to-pubsub %s (commit %s, built %s)\n", Version, GitCommit, BuildDate)
+}
+
+func init() {
+	RootCmd.Version = Version
+	RootCmd.SetVersionTemplate(versionString())
+	RootCmd.AddCommand(versionCmd)
+}
@@ -0,0 +1,177 @@
+package forwarder
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strings"
+	"sync/atomic"
+
+	"github.com/karnott/pubsub-to-pubsub/util"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	pausePath  = "/pause"
+	resumePath = "/resume"
+	statusPath = "/status"
+	// logLevelPath reads the log level and format with GET and sets them
+	// with PUT
+	logLevelPath = "/loglevel"
+)
+
+// bearerPrefix starts the Authorization header of authenticated admin requests
+const bearerPrefix = "Bearer "
+
+// pauseSwitch is shared by the forwarders to stop forwarding without
+// stopping to receive, accessed atomically
+type pauseSwitch struct {
+	paused int32
+}
+
+func (p *pauseSwitch) set(paused bool) {
+	var v int32
+	if paused {
+		v = 1
+	}
+	atomic.StoreInt32(&p.paused, v)
+}
+
+func (p *pauseSwitch) isPaused() bool {
+	return p != nil && atomic.LoadInt32(&p.paused) == 1
+}
+
+// Pause stops forwarding, received messages are nacked until Resume
+func (fw *Forwarder) Pause() {
+	fw.pause.set(true)
+	logrus.Warn("Forwarding paused, messages are nacked")
+}
+
+// Resume resumes forwarding after Pause
+func (fw *Forwarder) Resume() {
+	fw.pause.set(false)
+	logrus.Info("Forwarding resumed")
+}
+
+// Paused reports whether forwarding is paused
+func (fw *Forwarder) Paused() bool {
+	return fw.pause.isPaused()
+}
+
+// adminStatus is the body of the status endpoint
+type adminStatus struct {
+	Paused bool `json:"paused"`
+	// Circuits holds the circuit breaker state of each subscription, when
+	// the circuit breaker is enabled
+	Circuits map[string]string `json:"circuits,omitempty"`
+}
+
+// adminLogLevel is the body of the log level endpoint
+type adminLogLevel struct {
+	Level  string `json:"level"`
+	Format string `json:"format,omitempty"`
+}
+
+// registerAdmin exposes the pause, resume, status and log level endpoints of
+// fw on mux, requiring the bearer token when it is set
+func registerAdmin(mux *http.ServeMux, token string, fw *Forwarder) {
+	mux.Handle(pausePath, adminHandler(token, http.MethodPost, func(w http.ResponseWriter, r *http.Request) {
+		fw.Pause()
+		writeStatus(w, fw)
+	}))
+	mux.Handle(resumePath, adminHandler(token, http.MethodPost, func(w http.ResponseWriter, r *http.Request) {
+		fw.Resume()
+		writeStatus(w, fw)
+	}))
+	mux.Handle(statusPath, adminHandler(token, http.MethodGet, func(w http.ResponseWriter, r *http.Request) {
+		writeStatus(w, fw)
+	}))
+	mux.Handle(logLevelPath, adminMethodsHandler(token, map[string]http.HandlerFunc{
+		http.MethodGet: func(w http.ResponseWriter, r *http.Request) {
+			writeLogLevel(w)
+		},
+		http.MethodPut: func(w http.ResponseWriter, r *http.Request) {
+			query := r.URL.Query()
+			levelParam, format := query.Get("level"), query.Get("format")
+			if levelParam == "" && format == "" {
+				http.Error(w, "level or format must be set", http.StatusBadRequest)
+				return
+			}
+			// both are checked before either is changed
+			var level logrus.Level
+			if levelParam != "" {
+				var err error
+				if level, err = logrus.ParseLevel(levelParam); err != nil {
+					http.Error(w, err.Error(), http.StatusBadRequest)
+					return
+				}
+			}
+			if format != "" {
+				if err := util.SetLogFormat(format); err != nil {
+					http.Error(w, err.Error(), http.StatusBadRequest)
+					return
+				}
+				logrus.Warnf("Log format set to %s", format)
+			}
+			if levelParam != "" {
+				logrus.SetLevel(level)
+				logrus.Warnf("Log level set to %s", level)
+			}
+			writeLogLevel(w)
+		},
+	}))
+}
+
+// adminHandler serves requests of method only, authenticated by the bearer
+// token when it is set
+func adminHandler(token, method string, next http.HandlerFunc) http.Handler {
+	return adminMethodsHandler(token, map[string]http.HandlerFunc{method: next})
+}
+
+// adminMethodsHandler serves requests with the handler of their method,
+// authenticated by the bearer token when it is set
+func adminMethodsHandler(token string, handlers map[string]http.HandlerFunc) http.Handler {
+	allowed := make([]string, 0, len(handlers))
+	for method := range handlers {
+		allowed = append(allowed, method)
+	}
+	sort.Strings(allowed)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		next, ok := handlers[r.Method]
+		if !ok {
+			w.Header().Set("Allow", strings.Join(allowed, ", "))
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		if token != "" {
+			// a bare token is refused, it would otherwise be compared as is
+			auth := r.Header.Get("Authorization")
+			if !strings.HasPrefix(auth, bearerPrefix) || subtle.ConstantTimeCompare([]byte(auth[len(bearerPrefix):]), []byte(token)) != 1 {
+				http.Error(w, "unauthorized", http.StatusUnauthorized)
+				return
+			}
+		}
+		next(w, r)
+	})
+}
+
+func writeStatus(w http.ResponseWriter, fw *Forwarder) {
+	w.Header().Set("Content-Type", "application/json")
+	status := adminStatus{Paused: fw.Paused()}
+	for _, f := range fw.forwarders {
+		if f.breaker == nil {
+			continue
+		}
+		if status.Circuits == nil {
+			status.Circuits = map[string]string{}
+		}
+		status.Circuits[f.mapping.PubSubSubscription] = f.breaker.current()
+	}
+	_ = json.NewEncoder(w).Encode(status)
+}
+
+func writeLogLevel(w http.ResponseWriter) {
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(adminLogLevel{Level: logrus.GetLevel().String(), Format: util.LogFormat()})
+}
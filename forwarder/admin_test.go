@@ -0,0 +1,36 @@
+package forwarder
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestAdminHandlerToken(t *testing.T) {
+	handler := adminHandler("secret", http.MethodGet, func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+	for _, tc := range []struct {
+		name          string
+		authorization string
+		wantStatus    int
+	}{
+		{name: "bearer token", authorization: "Bearer secret", wantStatus: http.StatusOK},
+		{name: "missing header", wantStatus: http.StatusUnauthorized},
+		{name: "bare token", authorization: "secret", wantStatus: http.StatusUnauthorized},
+		{name: "wrong token", authorization: "Bearer other", wantStatus: http.StatusUnauthorized},
+		{name: "other scheme", authorization: "Basic secret", wantStatus: http.StatusUnauthorized},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, statusPath, nil)
+			if tc.authorization != "" {
+				req.Header.Set("Authorization", tc.authorization)
+			}
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+			if rec.Code != tc.wantStatus {
+				t.Errorf("status = %d, want %d", rec.Code, tc.wantStatus)
+			}
+		})
+	}
+}
@@ -0,0 +1,131 @@
+package forwarder
+
+import (
+	"fmt"
+	"strings"
+)
+
+// attributeFilter selects which message attributes are forwarded and under
+// which names
+type attributeFilter struct {
+	allow map[string]bool
+	block map[string]bool
+	// rename maps attributes to their forwarded name, attributes mapped to
+	// an empty name being dropped
+	rename map[string]string
+}
+
+func newAttributeFilter(allow, block []string, rename map[string]string) attributeFilter {
+	return attributeFilter{
+		allow:  toSet(allow),
+		block:  toSet(block),
+		rename: rename,
+	}
+}
+
+// apply returns a copy of attrs holding only the forwarded attributes. When
+// an allowlist is set only its keys are kept, then blocklisted keys are
+// removed and the remaining ones renamed, a renamed attribute replacing the
+// attribute already named after its target.
+func (a attributeFilter) apply(attrs map[string]string) map[string]string {
+	if len(attrs) == 0 {
+		return nil
+	}
+	out := make(map[string]string, len(attrs))
+	for k, v := range attrs {
+		if _, ok := a.rename[k]; ok || !a.keeps(k) {
+			continue
+		}
+		out[k] = v
+	}
+	for from, to := range a.rename {
+		if v, ok := attrs[from]; ok && to != "" && a.keeps(from) {
+			out[to] = v
+		}
+	}
+	return out
+}
+
+// keeps reports whether the attribute k passes the allowlist and blocklist
+func (a attributeFilter) keeps(k string) bool {
+	if len(a.allow) > 0 && !a.allow[k] {
+		return false
+	}
+	return !a.block[k]
+}
+
+// parseAttributeMapping parses from=to renames, an empty target dropping the
+// attribute. An attribute can only be mapped once and to a target no other
+// attribute is mapped to.
+func parseAttributeMapping(pairs []string) (map[string]string, error) {
+	if len(pairs) == 0 {
+		return nil, nil
+	}
+	rename := make(map[string]string, len(pairs))
+	targets := make(map[string]string, len(pairs))
+	for _, pair := range pairs {
+		kv := strings.SplitN(pair, "=", 2)
+		if len(kv) != 2 || kv[0] == "" {
+			return nil, fmt.Errorf("%q is not a from=to pair", pair)
+		}
+		from, to := kv[0], kv[1]
+		if _, ok := rename[from]; ok {
+			return nil, fmt.Errorf("attribute %q is mapped more than once", from)
+		}
+		if other, ok := targets[to]; ok && to != "" {
+			return nil, fmt.Errorf("attributes %q and %q are both mapped to %q", other, from, to)
+		}
+		rename[from] = to
+		targets[to] = from
+	}
+	return rename, nil
+}
+
+func toSet(values []string) map[string]bool {
+	if len(values) == 0 {
+		return nil
+	}
+	set := make(map[string]bool, len(values))
+	for _, v := range values {
+		set[v] = true
+	}
+	return set
+}
+
+// forwardedAtAttribute is the attribute holding the time a message was forwarded at
+const forwardedAtAttribute = "forwarded-at"
+
+// forwardSeqAttribute is the attribute holding the rank of a message in the
+// publishes of the process
+const forwardSeqAttribute = "forward_seq"
+
+// parseAttributes parses key=value pairs into an attributes map
+func parseAttributes(pairs []string) (map[string]string, error) {
+	if len(pairs) == 0 {
+		return nil, nil
+	}
+	attrs := make(map[string]string, len(pairs))
+	for _, pair := range pairs {
+		kv := strings.SplitN(pair, "=", 2)
+		if len(kv) != 2 || kv[0] == "" {
+			return nil, fmt.Errorf("%q is not a key=value pair", pair)
+		}
+		attrs[kv[0]] = kv[1]
+	}
+	return attrs, nil
+}
+
+// missingAttributesLogged is the number of messages rejected for a missing
+// required attribute that are logged by each forwarder
+const missingAttributesLogged = 10
+
+// missingAttribute returns the first of the required attributes missing
+// from attrs, empty when none is
+func missingAttribute(attrs map[string]string, required []string) string {
+	for _, k := range required {
+		if _, ok := attrs[k]; !ok {
+			return k
+		}
+	}
+	return ""
+}
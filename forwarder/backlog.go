@@ -0,0 +1,110 @@
+package forwarder
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	monitoring "cloud.google.com/go/monitoring/apiv3/v2"
+	"github.com/sirupsen/logrus"
+	"google.golang.org/api/iterator"
+	"google.golang.org/api/option"
+	monitoringpb "google.golang.org/genproto/googleapis/monitoring/v3"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+const (
+	// backlogMetric is the number of unacked messages of a subscription
+	backlogMetric = "pubsub.googleapis.com/subscription/num_undelivered_messages"
+	// backlogLookback is the window searched for the latest backlog sample,
+	// pubsub metrics being sampled every minute and delayed by a few minutes
+	backlogLookback = 10 * time.Minute
+	// monitoringReadScope is the OAuth scope of the backlog queries
+	monitoringReadScope = "https://www.googleapis.com/auth/monitoring.read"
+)
+
+// backlogMonitor logs the backlog of the subscriptions of the forwarders
+type backlogMonitor struct {
+	client     *monitoring.MetricClient
+	forwarders []*forwarder
+}
+
+func newBacklogMonitor(ctx context.Context, forwarders []*forwarder, opts ...option.ClientOption) (*backlogMonitor, error) {
+	client, err := monitoring.NewMetricClient(ctx, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return &backlogMonitor{client: client, forwarders: forwarders}, nil
+}
+
+// run logs the backlogs every interval until ctx is done
+func (b *backlogMonitor) run(ctx context.Context, interval time.Duration) {
+	defer b.client.Close()
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		b.logBacklogs(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (b *backlogMonitor) logBacklogs(ctx context.Context) {
+	for _, f := range b.forwarders {
+		log := logrus.
+			WithField(logFieldSubscription, f.mapping.PubSubSubscription).
+			WithField(logFieldDestinationTopic, f.mapping.PubSubDestinationTopic)
+		backlog, ok, err := b.backlog(ctx, f.sub.String())
+		if err != nil {
+			if ctx.Err() == nil {
+				log.Warnf("err when querying the subscription backlog: %v", err)
+			}
+			continue
+		}
+		if !ok {
+			log.Info("Subscription backlog is not reported yet")
+			continue
+		}
+		subscriptionBacklog.WithLabelValues(f.labels()...).Set(float64(backlog))
+		log.WithField("num-undelivered-messages", backlog).Info("Subscription backlog")
+	}
+}
+
+// backlog returns the latest number of undelivered messages of the
+// projects/<project>/subscriptions/<id> subscription, ok being false when
+// no sample was reported in the lookback window
+func (b *backlogMonitor) backlog(ctx context.Context, subscription string) (backlog int64, ok bool, err error) {
+	project, id, _ := parseResource(subscription, collectionSubscriptions)
+	now := time.Now()
+	it := b.client.ListTimeSeries(ctx, &monitoringpb.ListTimeSeriesRequest{
+		Name:   "projects/" + project,
+		Filter: fmt.Sprintf(`metric.type = %q AND resource.labels.subscription_id = %q`, backlogMetric, id),
+		Interval: &monitoringpb.TimeInterval{
+			StartTime: timestamppb.New(now.Add(-backlogLookback)),
+			EndTime:   timestamppb.New(now),
+		},
+		View: monitoringpb.ListTimeSeriesRequest_FULL,
+	})
+	var latest time.Time
+	for {
+		series, err := it.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			return 0, false, err
+		}
+		// points are returned newest first
+		if points := series.GetPoints(); len(points) > 0 {
+			if t := points[0].GetInterval().GetEndTime().AsTime(); t.After(latest) {
+				latest = t
+				backlog = points[0].GetValue().GetInt64Value()
+				ok = true
+			}
+		}
+	}
+	return backlog, ok, nil
+}
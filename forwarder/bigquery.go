@@ -0,0 +1,235 @@
+package forwarder
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"cloud.google.com/go/bigquery"
+	"cloud.google.com/go/bigquery/storage/managedwriter"
+	"cloud.google.com/go/bigquery/storage/managedwriter/adapt"
+	"cloud.google.com/go/pubsub"
+	"github.com/sirupsen/logrus"
+	"google.golang.org/api/option"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+// bigQueryMaxBatchRows is the number of rows appended at once, a batch being
+// appended earlier when the flush interval elapses
+const bigQueryMaxBatchRows = 500
+
+// bigQueryResult is the result of a row, known once its batch is appended
+type bigQueryResult struct {
+	done chan struct{}
+	err  error
+}
+
+func newBigQueryResult() *bigQueryResult {
+	return &bigQueryResult{done: make(chan struct{})}
+}
+
+func (r *bigQueryResult) resolve(err error) {
+	r.err = err
+	close(r.done)
+}
+
+func (r *bigQueryResult) Get(ctx context.Context) (string, error) {
+	select {
+	case <-r.done:
+		return "", r.err
+	case <-ctx.Done():
+		return "", ctx.Err()
+	}
+}
+
+// bigQueryPublisher inserts the JSON data of messages as rows of a table
+// with the default stream of the storage write API, shared by every
+// forwarder. Rows are appended in batches, every flushInterval or once
+// bigQueryMaxBatchRows are pending.
+type bigQueryPublisher struct {
+	client  *managedwriter.Client
+	stream  *managedwriter.ManagedStream
+	message protoreflect.MessageDescriptor
+	table   string
+
+	flushInterval time.Duration
+
+	mu      sync.Mutex
+	rows    [][]byte
+	results []*bigQueryResult
+	// refs is the number of forwarders inserting to the table, the stream
+	// is closed when the last one stops
+	refs    int
+	stopped bool
+	done    chan struct{}
+	// appends tracks the batches awaiting their append result
+	appends sync.WaitGroup
+}
+
+// newBigQueryPublisher connects to the table of dataset in project, reading
+// its schema to encode the rows
+func newBigQueryPublisher(ctx context.Context, project, dataset, table string, flushInterval time.Duration, opts ...option.ClientOption) (*bigQueryPublisher, error) {
+	bq, err := bigquery.NewClient(ctx, project, opts...)
+	if err != nil {
+		return nil, err
+	}
+	meta, err := bq.Dataset(dataset).Table(table).Metadata(ctx)
+	bq.Close()
+	if err != nil {
+		return nil, fmt.Errorf("could not read the schema of table %s.%s: %w", dataset, table, err)
+	}
+
+	schema, err := adapt.BQSchemaToStorageTableSchema(meta.Schema)
+	if err != nil {
+		return nil, err
+	}
+	d, err := adapt.StorageSchemaToProto2Descriptor(schema, "root")
+	if err != nil {
+		return nil, err
+	}
+	message, ok := d.(protoreflect.MessageDescriptor)
+	if !ok {
+		return nil, fmt.Errorf("schema of table %s.%s is not a message", dataset, table)
+	}
+	normalized, err := adapt.NormalizeDescriptor(message)
+	if err != nil {
+		return nil, err
+	}
+
+	client, err := managedwriter.NewClient(ctx, project, opts...)
+	if err != nil {
+		return nil, err
+	}
+	path := managedwriter.TableParentFromParts(project, dataset, table)
+	stream, err := client.NewManagedStream(ctx,
+		managedwriter.WithDestinationTable(path),
+		managedwriter.WithType(managedwriter.DefaultStream),
+		managedwriter.WithSchemaDescriptor(normalized),
+	)
+	if err != nil {
+		client.Close()
+		return nil, err
+	}
+
+	p := &bigQueryPublisher{
+		client:        client,
+		stream:        stream,
+		message:       message,
+		table:         path,
+		flushInterval: flushInterval,
+		done:          make(chan struct{}),
+	}
+	go p.flushLoop()
+	return p, nil
+}
+
+// acquire returns the publisher for one more forwarder
+func (p *bigQueryPublisher) acquire() publisher {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.refs++
+	return p
+}
+
+// Publish queues the JSON data of msg as a row. Data that does not match the
+// table schema can never be inserted, its result is a rejectedError.
+func (p *bigQueryPublisher) Publish(_ context.Context, msg *pubsub.Message) publishResult {
+	res := newBigQueryResult()
+	row := dynamicpb.NewMessage(p.message)
+	if err := protojson.Unmarshal(msg.Data, row); err != nil {
+		res.resolve(&rejectedError{err: fmt.Errorf("data is not a row of table %s: %w", p.table, err)})
+		return res
+	}
+	data, err := proto.Marshal(row)
+	if err != nil {
+		res.resolve(&rejectedError{err: err})
+		return res
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.stopped {
+		res.resolve(fmt.Errorf("table %s writer is closed", p.table))
+		return res
+	}
+	p.rows = append(p.rows, data)
+	p.results = append(p.results, res)
+	if len(p.rows) >= bigQueryMaxBatchRows {
+		p.flush()
+	}
+	return res
+}
+
+// flush appends the pending rows, the caller holding the lock
+func (p *bigQueryPublisher) flush() {
+	if len(p.rows) == 0 {
+		return
+	}
+	rows, results := p.rows, p.results
+	p.rows, p.results = nil, nil
+
+	// the append outlives the publish contexts so that a shutdown does not
+	// lose rows already queued
+	ctx := context.Background()
+	ar, err := p.stream.AppendRows(ctx, rows)
+	if err != nil {
+		for _, r := range results {
+			r.resolve(err)
+		}
+		return
+	}
+	p.appends.Add(1)
+	go func() {
+		defer p.appends.Done()
+		_, err := ar.GetResult(ctx)
+		for _, r := range results {
+			r.resolve(err)
+		}
+	}()
+}
+
+// flushLoop appends the pending rows every flushInterval
+func (p *bigQueryPublisher) flushLoop() {
+	ticker := time.NewTicker(p.flushInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-p.done:
+			return
+		case <-ticker.C:
+		}
+		p.mu.Lock()
+		p.flush()
+		p.mu.Unlock()
+	}
+}
+
+// Stop appends the pending rows and closes the stream once every forwarder
+// inserting to the table has stopped
+func (p *bigQueryPublisher) Stop() {
+	p.mu.Lock()
+	if p.refs--; p.refs > 0 || p.stopped {
+		p.mu.Unlock()
+		return
+	}
+	p.stopped = true
+	close(p.done)
+	p.flush()
+	p.mu.Unlock()
+
+	p.appends.Wait()
+	if err := p.stream.Close(); err != nil {
+		logrus.Errorf("err when closing table %s writer: %v", p.table, err)
+	}
+	if err := p.client.Close(); err != nil {
+		logrus.Errorf("err when closing bigquery client: %v", err)
+	}
+}
+
+func (p *bigQueryPublisher) String() string {
+	return p.table
+}
@@ -0,0 +1,127 @@
+package forwarder
+
+import (
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// circuit breaker states
+const (
+	circuitClosed   = "closed"
+	circuitOpen     = "open"
+	circuitHalfOpen = "half-open"
+)
+
+// circuitBreaker stops forwarding after consecutive publish failures. Once
+// open, messages are nacked until the reset timeout elapsed, then a single
+// message is let through to probe the destination: its success closes the
+// circuit, its failure opens it again.
+type circuitBreaker struct {
+	threshold    int
+	resetTimeout time.Duration
+	log          *logrus.Entry
+	labels       []string
+
+	mu       sync.Mutex
+	state    string
+	failures int
+	// openedAt is when the circuit opened, probeAt when the probe was let
+	// through, a lost probe being replaced after the reset timeout
+	openedAt time.Time
+	probeAt  time.Time
+}
+
+func newCircuitBreaker(threshold int, resetTimeout time.Duration, log *logrus.Entry, labels []string) *circuitBreaker {
+	return &circuitBreaker{
+		threshold:    threshold,
+		resetTimeout: resetTimeout,
+		log:          log,
+		labels:       labels,
+		state:        circuitClosed,
+	}
+}
+
+// allow reports whether a message can be forwarded, always when b is nil
+func (b *circuitBreaker) allow() bool {
+	if b == nil {
+		return true
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	now := time.Now()
+	switch b.state {
+	case circuitOpen:
+		if now.Sub(b.openedAt) < b.resetTimeout {
+			return false
+		}
+		b.set(circuitHalfOpen)
+		b.probeAt = now
+		b.log.Infof("Circuit half-open, probing the destination")
+		return true
+	case circuitHalfOpen:
+		// the probe may have been filtered or dropped before its publish
+		if now.Sub(b.probeAt) < b.resetTimeout {
+			return false
+		}
+		b.probeAt = now
+		return true
+	}
+	return true
+}
+
+// success records a successful publish, closing the circuit
+func (b *circuitBreaker) success() {
+	if b == nil {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.failures = 0
+	if b.state != circuitClosed {
+		b.set(circuitClosed)
+		b.log.Info("Circuit closed, forwarding resumed")
+	}
+}
+
+// failure records a failed publish, opening the circuit after threshold
+// consecutive failures or when the probe failed
+func (b *circuitBreaker) failure() {
+	if b == nil {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.failures++
+	switch {
+	case b.state == circuitHalfOpen:
+		b.set(circuitOpen)
+		b.openedAt = time.Now()
+		b.log.Warnf("Probe failed, circuit open again, messages are nacked for %s", b.resetTimeout)
+	case b.state == circuitClosed && b.failures >= b.threshold:
+		b.set(circuitOpen)
+		b.openedAt = time.Now()
+		b.log.Warnf("Circuit open after %d consecutive publish failures, messages are nacked for %s", b.failures, b.resetTimeout)
+	}
+}
+
+// current returns the state of the circuit, closed when b is nil
+func (b *circuitBreaker) current() string {
+	if b == nil {
+		return circuitClosed
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.state
+}
+
+// set changes the state of the circuit, b.mu being held
+func (b *circuitBreaker) set(state string) {
+	b.state = state
+	open := 0.0
+	if state != circuitClosed {
+		open = 1
+	}
+	circuitBreakerOpen.WithLabelValues(b.labels...).Set(open)
+}
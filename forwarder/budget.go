@@ -0,0 +1,81 @@
+package forwarder
+
+import (
+	"sync"
+	"sync/atomic"
+
+	"github.com/sirupsen/logrus"
+)
+
+// forwardBudget bounds the messages and bytes forwarded by a run, shared by
+// the forwarders and updated atomically. A message takes its share of the
+// budget before being published and gives it back when the publish fails, so
+// that no more than the budget is forwarded when publishes run concurrently.
+type forwardBudget struct {
+	maxMessages int64
+	maxBytes    int64
+
+	// messages and bytes are taken by the messages being published or
+	// forwarded, forwarded and forwardedBytes by the forwarded ones only
+	messages       int64
+	bytes          int64
+	forwarded      int64
+	forwardedBytes int64
+
+	// stop stops the run once the budget is forwarded
+	stop func()
+	once sync.Once
+}
+
+// newForwardBudget returns the budget of maxMessages messages and maxBytes
+// bytes, nil when both are 0 for no limit
+func newForwardBudget(maxMessages, maxBytes int) *forwardBudget {
+	if maxMessages <= 0 && maxBytes <= 0 {
+		return nil
+	}
+	return &forwardBudget{maxMessages: int64(maxMessages), maxBytes: int64(maxBytes)}
+}
+
+// take takes the share of a message of size bytes, returning false when the
+// budget is spent. The byte budget admits the message that crosses it.
+func (b *forwardBudget) take(size int) bool {
+	if b == nil {
+		return true
+	}
+	if n := atomic.AddInt64(&b.messages, 1); b.maxMessages > 0 && n > b.maxMessages {
+		atomic.AddInt64(&b.messages, -1)
+		return false
+	}
+	if n := atomic.AddInt64(&b.bytes, int64(size)); b.maxBytes > 0 && n-int64(size) >= b.maxBytes {
+		atomic.AddInt64(&b.bytes, -int64(size))
+		atomic.AddInt64(&b.messages, -1)
+		return false
+	}
+	return true
+}
+
+// giveBack returns the share of a message of size bytes that was not
+// forwarded
+func (b *forwardBudget) giveBack(size int) {
+	if b == nil {
+		return
+	}
+	atomic.AddInt64(&b.bytes, -int64(size))
+	atomic.AddInt64(&b.messages, -1)
+}
+
+// spend records a forwarded message of size bytes, stopping the run once
+// the budget is forwarded
+func (b *forwardBudget) spend(size int) {
+	if b == nil {
+		return
+	}
+	n := atomic.AddInt64(&b.forwarded, 1)
+	bytes := atomic.AddInt64(&b.forwardedBytes, int64(size))
+	if (b.maxMessages > 0 && n >= b.maxMessages) || (b.maxBytes > 0 && bytes >= b.maxBytes) {
+		b.once.Do(func() {
+			logrus.Infof("Forwarded %d messages of %d bytes, the max messages or bytes is reached", n, bytes)
+			b.stop()
+		})
+	}
+}
@@ -0,0 +1,157 @@
+package forwarder
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"sync"
+
+	"github.com/linkedin/goavro/v2"
+)
+
+// built-in codecs
+const (
+	CodecJSON = "json"
+	CodecAvro = "avro"
+)
+
+// Codec decodes message data to a value and encodes values back to message
+// data, to transcode messages between serialization formats. Values are the
+// ones of encoding/json: maps, slices, strings, float64, bool and nil.
+type Codec interface {
+	Decode(data []byte) (interface{}, error)
+	Encode(v interface{}) ([]byte, error)
+}
+
+// NewCodecFunc creates a codec from the forwarder configuration
+type NewCodecFunc func(cfg Config) (Codec, error)
+
+var (
+	codecsMu sync.RWMutex
+	codecs   = map[string]NewCodecFunc{
+		CodecJSON: func(Config) (Codec, error) { return jsonCodec{}, nil },
+		CodecAvro: newAvroCodec,
+	}
+)
+
+// RegisterCodec registers a codec under name for the InputCodec and
+// OutputCodec settings, replacing any codec of that name
+func RegisterCodec(name string, newCodec NewCodecFunc) {
+	codecsMu.Lock()
+	defer codecsMu.Unlock()
+	codecs[name] = newCodec
+}
+
+// codecNames returns the sorted names of the registered codecs
+func codecNames() []string {
+	codecsMu.RLock()
+	defer codecsMu.RUnlock()
+	names := make([]string, 0, len(codecs))
+	for name := range codecs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// newCodec creates the codec registered under name
+func newCodec(name string, cfg Config) (Codec, error) {
+	codecsMu.RLock()
+	newCodec, ok := codecs[name]
+	codecsMu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("unknown codec %q", name)
+	}
+	return newCodec(cfg)
+}
+
+// transcoder decodes message data with one codec and encodes it with another
+type transcoder struct {
+	input  Codec
+	output Codec
+}
+
+func newTranscoder(cfg Config) (*transcoder, error) {
+	input, err := newCodec(cfg.InputCodec, cfg)
+	if err != nil {
+		return nil, err
+	}
+	output, err := newCodec(cfg.OutputCodec, cfg)
+	if err != nil {
+		return nil, err
+	}
+	return &transcoder{input: input, output: output}, nil
+}
+
+func (t *transcoder) transcode(data []byte) ([]byte, error) {
+	v, err := t.input.Decode(data)
+	if err != nil {
+		return nil, fmt.Errorf("could not decode data: %w", err)
+	}
+	out, err := t.output.Encode(v)
+	if err != nil {
+		return nil, fmt.Errorf("could not encode data: %w", err)
+	}
+	return out, nil
+}
+
+// jsonCodec is the codec of JSON data
+type jsonCodec struct{}
+
+func (jsonCodec) Decode(data []byte) (interface{}, error) {
+	var v interface{}
+	err := json.Unmarshal(data, &v)
+	return v, err
+}
+
+func (jsonCodec) Encode(v interface{}) ([]byte, error) {
+	return json.Marshal(v)
+}
+
+// avroCodec is the codec of binary Avro data of the codec schema file.
+// Values go through the JSON encoding of Avro, where the values of unions
+// other than null are wrapped in an object keyed by their type, e.g.
+// {"string": "value"}.
+type avroCodec struct {
+	codec *goavro.Codec
+}
+
+func newAvroCodec(cfg Config) (Codec, error) {
+	if cfg.CodecSchemaFile == "" {
+		return nil, fmt.Errorf("the %s codec needs a schema file", CodecAvro)
+	}
+	schema, err := os.ReadFile(cfg.CodecSchemaFile)
+	if err != nil {
+		return nil, err
+	}
+	codec, err := goavro.NewCodec(string(schema))
+	if err != nil {
+		return nil, err
+	}
+	return &avroCodec{codec: codec}, nil
+}
+
+func (c *avroCodec) Decode(data []byte) (interface{}, error) {
+	native, _, err := c.codec.NativeFromBinary(data)
+	if err != nil {
+		return nil, err
+	}
+	text, err := c.codec.TextualFromNative(nil, native)
+	if err != nil {
+		return nil, err
+	}
+	return jsonCodec{}.Decode(text)
+}
+
+func (c *avroCodec) Encode(v interface{}) ([]byte, error) {
+	text, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	native, _, err := c.codec.NativeFromTextual(text)
+	if err != nil {
+		return nil, err
+	}
+	return c.codec.BinaryFromNative(nil, native)
+}
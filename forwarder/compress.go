@@ -0,0 +1,37 @@
+package forwarder
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+)
+
+const (
+	// contentEncodingAttribute is the attribute naming the encoding of the
+	// message data
+	contentEncodingAttribute = "content-encoding"
+	contentEncodingGzip      = "gzip"
+)
+
+// gunzip returns the decompressed gzip data
+func gunzip(data []byte) ([]byte, error) {
+	r, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	return io.ReadAll(r)
+}
+
+// gzipData returns data compressed with gzip
+func gzipData(data []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	w := gzip.NewWriter(&buf)
+	if _, err := w.Write(data); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
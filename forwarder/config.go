@@ -0,0 +1,143 @@
+package forwarder
+
+import "time"
+
+// Config configuration of a Forwarder
+type Config struct {
+	FromGoogleApplicationCredentials     string
+	ToGoogleApplicationCredentials       string
+	FromGoogleApplicationCredentialsFile string
+	ToGoogleApplicationCredentialsFile   string
+	ShutdownTimeout                      time.Duration
+	Mappings                             []Mapping
+	PublishProfiles                      map[string]PublishProfile
+	MetricsAddr                          string
+	AttributeAllowlist                   []string
+	AttributeBlocklist                   []string
+	AttributeMapping                     []string
+	MaxOutstandingMessages               int
+	MaxOutstandingBytes                  int
+	DeadLetterTopic                      string
+	MaxPublishRetries                    int
+	PublishMaxAttempts                   int
+	PublishInitialBackoff                time.Duration
+	PublishMaxBackoff                    time.Duration
+	HealthAddr                           string
+	TransformCEL                         string
+	DryRun                               bool
+	DryRunAck                            bool
+	DestinationType                      string
+	PubSubLiteLocation                   string
+	EmulatorHost                         string
+	FilterAttribute                      string
+	FilterValues                         []string
+	FilterCaseInsensitive                bool
+	DataMatchRegex                       string
+	PublishCountThreshold                int
+	PublishByteThreshold                 int
+	PublishDelayThreshold                time.Duration
+	PublishAsyncAck                      bool
+	Endpoint                             string
+	CACertFile                           string
+	ClientCertFile                       string
+	ClientKeyFile                        string
+	DynamicTopicAttribute                string
+	TopicTemplate                        string
+	ReceiveMaxRetries                    int
+	ReceiveBackoffMax                    time.Duration
+	ReceiveAuthRetries                   int
+	FanOutMode                           string
+	OtelEndpoint                         string
+	OtelInsecure                         bool
+	DestinationFile                      string
+	DestinationFileMaxBytes              int
+	DecompressGzip                       bool
+	CompressGzip                         bool
+	MaxMessageBytes                      int
+	PublishConcurrency                   int
+	ReceiveGoroutines                    int
+	SynchronousPull                      bool
+	InjectAttributes                     []string
+	InjectForwardedTimestamp             bool
+	PreservePublishTime                  bool
+	PublishTimeAttribute                 string
+	StampSequence                        bool
+	FlowControlBehavior                  string
+	AckMode                              string
+	ValidateSchema                       bool
+	SchemaFile                           string
+	SchemaEncoding                       string
+	MaxPublishRate                       float64
+	PublishBurst                         int
+	DedupWindow                          time.Duration
+	DedupSize                            int
+	DedupAttribute                       string
+	PublishTimeout                       time.Duration
+	ErrorLogSample                       string
+	InputCodec                           string
+	OutputCodec                          string
+	CodecSchemaFile                      string
+	EnvelopeTemplate                     string
+	AdminAddr                            string
+	AdminToken                           string
+	AdminTLSCert                         string
+	AdminTLSKey                          string
+	BigQueryProject                      string
+	BigQueryDataset                      string
+	BigQueryTable                        string
+	BigQueryFlushInterval                time.Duration
+	RunDuration                          time.Duration
+	FromCredentialsKMSKey                string
+	ToCredentialsKMSKey                  string
+	MaxMessageAgeWarn                    time.Duration
+	RedeliveryTrackSize                  int
+	RedeliveryWarn                       time.Duration
+	RequireAttributes                    []string
+	GRPCKeepaliveTime                    time.Duration
+	GRPCKeepaliveTimeout                 time.Duration
+	// GRPCConnectionPool is the number of grpc connections of each client,
+	// the client library default when 0
+	GRPCConnectionPool      int
+	DrainIdle               time.Duration
+	MaxMessages             int
+	MaxBytes                int
+	OrderingKeyAttribute    string
+	IgnoreOrdering          bool
+	CircuitFailureThreshold int
+	CircuitResetTimeout     time.Duration
+	DestinationURL          string
+	DestinationTimeout      time.Duration
+	DestinationToken        string
+	ListAvailable           bool
+	FromCredentialsSecret   string
+	ToCredentialsSecret     string
+	MaxInflightPerKey       int
+	BacklogLogInterval      time.Duration
+	NackDelay               time.Duration
+	KafkaBrokers            []string
+	KafkaTopic              string
+	KafkaKeyAttribute       string
+	KafkaSASLMechanism      string
+	KafkaSASLUsername       string
+	KafkaSASLPassword       string
+	KafkaTLS                bool
+	KafkaCACertFile         string
+	// MinPublishTime is a RFC3339 timestamp, messages published before it
+	// being dropped
+	MinPublishTime string
+	PanicFatal     bool
+	// SampleRate is the fraction of the messages forwarded, above 0, all of
+	// them when 1
+	SampleRate          float64
+	SampleDeterministic bool
+	SampleAttribute     string
+	// MirrorTopic publishes the messages of each subscription to the topic
+	// named after its source topic, between MirrorTopicPrefix and
+	// MirrorTopicSuffix, in the destination project
+	MirrorTopic       bool
+	MirrorTopicPrefix string
+	MirrorTopicSuffix string
+
+	// Version is reported as the service version of traces
+	Version string
+}
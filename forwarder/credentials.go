@@ -0,0 +1,219 @@
+package forwarder
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+
+	kms "cloud.google.com/go/kms/apiv1"
+	secretmanager "cloud.google.com/go/secretmanager/apiv1"
+
+	"cloud.google.com/go/bigquery"
+	"cloud.google.com/go/pubsub"
+	"github.com/sirupsen/logrus"
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/google"
+	"google.golang.org/api/option"
+	kmspb "google.golang.org/genproto/googleapis/cloud/kms/v1"
+	secretmanagerpb "google.golang.org/genproto/googleapis/cloud/secretmanager/v1"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+)
+
+// EmulatorHostEnv is the environment variable set by the pubsub emulator tooling
+const EmulatorHostEnv = "PUBSUB_EMULATOR_HOST"
+
+// emulatorOptions returns the client options to connect to a pubsub emulator,
+// which requires no credentials
+func emulatorOptions(host string) []option.ClientOption {
+	return []option.ClientOption{
+		option.WithEndpoint(host),
+		option.WithoutAuthentication(),
+		option.WithGRPCDialOption(grpc.WithTransportCredentials(insecure.NewCredentials())),
+	}
+}
+
+// reloadableCredentials authenticates the clients with credentials that can
+// be loaded again, e.g. after a key rotation, without recreating the clients:
+// requests started before a reload keep the token they were sent with.
+type reloadableCredentials struct {
+	load func(ctx context.Context) (*google.Credentials, error)
+
+	mu     sync.RWMutex
+	tokens oauth2.TokenSource
+}
+
+// credentials returns the reloadable credentials loaded from the given JSON
+// credentials or credentials file, falling back to the Application Default
+// Credentials (e.g. Workload Identity) when both are empty. When secret is
+// set, the JSON credentials are the payload of that Secret Manager secret
+// version. When kmsKey is set, the credentials are ciphertext decrypted with
+// that Cloud KMS key, the JSON credentials being base64 encoded.
+func credentials(ctx context.Context, json, file, secret, kmsKey string, scopes []string) (*reloadableCredentials, error) {
+	c := &reloadableCredentials{load: func(ctx context.Context) (*google.Credentials, error) {
+		return loadCredentials(ctx, json, file, secret, kmsKey, scopes)
+	}}
+	if err := c.reload(ctx); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// reload loads the credentials again, the previous ones being kept when they
+// can not be loaded
+func (c *reloadableCredentials) reload(ctx context.Context) error {
+	creds, err := c.load(ctx)
+	if err != nil {
+		return err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.tokens = creds.TokenSource
+	return nil
+}
+
+// Token returns a token of the latest loaded credentials
+func (c *reloadableCredentials) Token() (*oauth2.Token, error) {
+	c.mu.RLock()
+	tokens := c.tokens
+	c.mu.RUnlock()
+	return tokens.Token()
+}
+
+// option returns the client option authenticating with c, nil when c is nil
+func (c *reloadableCredentials) option() option.ClientOption {
+	if c == nil {
+		return nil
+	}
+	return option.WithTokenSource(c)
+}
+
+// ReloadCredentials loads the credentials of the clients again, e.g. after
+// the key in the credentials file or secret was rotated. Requests sent from
+// then on authenticate with the new credentials, in flight ones complete with
+// the previous ones, which are kept when the new ones can not be loaded.
+func (fw *Forwarder) ReloadCredentials(ctx context.Context) error {
+	if len(fw.credentials) == 0 {
+		logrus.Info("No credentials to reload")
+		return nil
+	}
+	for _, c := range fw.credentials {
+		if err := c.reload(ctx); err != nil {
+			return withKind(KindCredentials, fmt.Errorf("could not reload credentials: %w", err))
+		}
+	}
+	logrus.Info("Credentials reloaded")
+	return nil
+}
+
+// loadCredentials loads the credentials described by credentials, reading
+// the file, secret or KMS key each time
+func loadCredentials(ctx context.Context, json, file, secret, kmsKey string, scopes []string) (*google.Credentials, error) {
+	if secret != "" {
+		payload, err := accessSecret(ctx, secret)
+		if err != nil {
+			return nil, err
+		}
+		json, file = string(payload), ""
+	}
+	if kmsKey != "" && (json != "" || file != "") {
+		plaintext, err := decryptCredentials(ctx, kmsKey, json, file)
+		if err != nil {
+			return nil, err
+		}
+		json, file = string(plaintext), ""
+	}
+	if file != "" {
+		b, err := os.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+		json = string(b)
+	}
+	if json == "" {
+		return google.FindDefaultCredentials(ctx, scopes...)
+	}
+	return google.CredentialsFromJSON(ctx, []byte(json), scopes...)
+}
+
+// decryptCredentials decrypts the JSON, base64 encoded, or file credentials
+// with the Cloud KMS key, authenticating to KMS with the Application Default
+// Credentials
+func decryptCredentials(ctx context.Context, kmsKey, json, file string) ([]byte, error) {
+	ciphertext, err := credentialsCiphertext(json, file)
+	if err != nil {
+		return nil, err
+	}
+	client, err := kms.NewKeyManagementClient(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("could not create kms client: %w", err)
+	}
+	defer client.Close()
+	res, err := client.Decrypt(ctx, &kmspb.DecryptRequest{Name: kmsKey, Ciphertext: ciphertext})
+	if err != nil {
+		return nil, fmt.Errorf("could not decrypt credentials with kms key %s: %w", kmsKey, err)
+	}
+	return res.Plaintext, nil
+}
+
+// accessSecret returns the payload of the Secret Manager secret version,
+// authenticating with the Application Default Credentials
+func accessSecret(ctx context.Context, secret string) ([]byte, error) {
+	client, err := secretmanager.NewClient(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("could not create secret manager client: %w", err)
+	}
+	defer client.Close()
+	res, err := client.AccessSecretVersion(ctx, &secretmanagerpb.AccessSecretVersionRequest{Name: secret})
+	if err != nil {
+		return nil, fmt.Errorf("could not access secret %s: %w", secret, err)
+	}
+	return res.GetPayload().GetData(), nil
+}
+
+// isSecretVersion reports whether name is a
+// projects/<project>/secrets/<secret>/versions/<version> resource name
+func isSecretVersion(name string) bool {
+	parts := strings.Split(name, "/")
+	return len(parts) == 6 && parts[0] == "projects" && parts[1] != "" &&
+		parts[2] == "secrets" && parts[3] != "" && parts[4] == "versions" && parts[5] != ""
+}
+
+// credentialsCiphertext returns the encrypted credentials of the file, or of
+// the base64 encoded JSON credentials
+func credentialsCiphertext(json, file string) ([]byte, error) {
+	if file != "" {
+		return os.ReadFile(file)
+	}
+	ciphertext, err := base64.StdEncoding.DecodeString(strings.TrimSpace(json))
+	if err != nil {
+		return nil, fmt.Errorf("encrypted credentials are not base64 encoded: %w", err)
+	}
+	return ciphertext, nil
+}
+
+// scopes returns the OAuth scopes of the credentials, the bigquery one being
+// needed by bigquery destinations and the monitoring one by backlog logging
+func (cfg *Config) scopes() []string {
+	scopes := []string{pubsub.ScopePubSub}
+	if cfg.DestinationType == DestinationTypeBigQuery {
+		scopes = append(scopes, bigquery.Scope)
+	}
+	if cfg.BacklogLogInterval > 0 {
+		scopes = append(scopes, monitoringReadScope)
+	}
+	return scopes
+}
+
+// sameCredentials reports whether the source and destination clients
+// authenticate with the same credentials
+func (cfg *Config) sameCredentials() bool {
+	return cfg.EmulatorHost != "" ||
+		cfg.FromGoogleApplicationCredentials == cfg.ToGoogleApplicationCredentials &&
+			cfg.FromGoogleApplicationCredentialsFile == cfg.ToGoogleApplicationCredentialsFile &&
+			cfg.FromCredentialsSecret == cfg.ToCredentialsSecret &&
+			cfg.FromCredentialsKMSKey == cfg.ToCredentialsKMSKey
+}
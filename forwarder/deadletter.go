@@ -0,0 +1,109 @@
+package forwarder
+
+import (
+	"container/list"
+	"context"
+	"strconv"
+	"sync"
+
+	"cloud.google.com/go/pubsub"
+)
+
+// attributes added to messages published to the dead-letter topic
+const (
+	deadLetterAttrError        = "dead_letter_error"
+	deadLetterAttrSubscription = "dead_letter_subscription"
+	deadLetterAttrMessageID    = "dead_letter_message_id"
+	deadLetterAttrAttempts     = "dead_letter_attempts"
+	deadLetterAttrDropReason   = "dead_letter_drop_reason"
+
+	// maxDeadLetterAttempts bounds the messages whose attempts are counted
+	// in memory, messages that expire or are delivered to another
+	// subscriber never being forgotten otherwise
+	maxDeadLetterAttempts = 100000
+)
+
+// deadLetter moves messages that repeatedly fail to publish to a dedicated topic
+type deadLetter struct {
+	topic      *pubsub.Topic
+	maxRetries int
+
+	// capacity is the number of messages whose attempts are counted,
+	// maxDeadLetterAttempts
+	capacity int
+
+	mu       sync.Mutex
+	attempts map[string]*list.Element
+	// order lists the counted messages from the most to the least recently
+	// failed, the least recently failed being evicted first
+	order *list.List
+}
+
+type deadLetterAttempts struct {
+	id       string
+	attempts int
+}
+
+func newDeadLetter(topic *pubsub.Topic, maxRetries int) *deadLetter {
+	return &deadLetter{
+		topic:      topic,
+		maxRetries: maxRetries,
+		capacity:   maxDeadLetterAttempts,
+		attempts:   map[string]*list.Element{},
+		order:      list.New(),
+	}
+}
+
+// failed records a failed publish of msg and returns the number of attempts
+// so far. The subscription delivery attempt is used when the subscription has
+// a dead-letter policy, otherwise attempts are counted in memory.
+func (d *deadLetter) failed(msg *pubsub.Message) int {
+	if msg.DeliveryAttempt != nil {
+		return *msg.DeliveryAttempt
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if e, ok := d.attempts[msg.ID]; ok {
+		d.order.MoveToFront(e)
+		a := e.Value.(*deadLetterAttempts)
+		a.attempts++
+		return a.attempts
+	}
+	d.attempts[msg.ID] = d.order.PushFront(&deadLetterAttempts{id: msg.ID, attempts: 1})
+	for d.order.Len() > d.capacity {
+		oldest := d.order.Back()
+		d.order.Remove(oldest)
+		delete(d.attempts, oldest.Value.(*deadLetterAttempts).id)
+	}
+	return 1
+}
+
+// forget drops the attempts counted for a message that left the subscription
+func (d *deadLetter) forget(msg *pubsub.Message) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if e, ok := d.attempts[msg.ID]; ok {
+		d.order.Remove(e)
+		delete(d.attempts, msg.ID)
+	}
+}
+
+// publish sends msg with the publish error metadata and the drop reason to
+// the dead-letter topic
+func (d *deadLetter) publish(ctx context.Context, subscription string, msg *pubsub.Message, attempts int, reason DropReason, cause error) error {
+	attrs := make(map[string]string, len(msg.Attributes)+5)
+	for k, v := range msg.Attributes {
+		attrs[k] = v
+	}
+	attrs[deadLetterAttrError] = cause.Error()
+	attrs[deadLetterAttrSubscription] = subscription
+	attrs[deadLetterAttrMessageID] = msg.ID
+	attrs[deadLetterAttrAttempts] = strconv.Itoa(attempts)
+	attrs[deadLetterAttrDropReason] = string(reason)
+
+	_, err := d.topic.Publish(ctx, &pubsub.Message{Data: msg.Data, Attributes: attrs}).Get(ctx)
+	if err == nil {
+		d.forget(msg)
+	}
+	return err
+}
@@ -0,0 +1,43 @@
+package forwarder
+
+import (
+	"testing"
+
+	"cloud.google.com/go/pubsub"
+)
+
+func TestDeadLetterAttemptsEviction(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		// failed are the IDs of the failed messages, in order
+		failed       []string
+		id           string
+		wantAttempts int
+	}{
+		{name: "counted below the cap", failed: []string{"a", "b", "a"}, id: "a", wantAttempts: 3},
+		{name: "oldest evicted at the cap", failed: []string{"a", "b", "c"}, id: "a", wantAttempts: 1},
+		{name: "newest kept at the cap", failed: []string{"a", "b", "c"}, id: "c", wantAttempts: 2},
+		{name: "failing again refreshes", failed: []string{"a", "b", "a", "c"}, id: "a", wantAttempts: 3},
+		{name: "least recently failed evicted", failed: []string{"a", "b", "a", "c"}, id: "b", wantAttempts: 1},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			d := newDeadLetter(nil, 5)
+			d.capacity = 2
+			for _, id := range tc.failed {
+				d.failed(&pubsub.Message{ID: id})
+			}
+			if d.order.Len() > d.capacity || len(d.attempts) > d.capacity {
+				t.Fatalf("%d messages counted, want at most %d", len(d.attempts), d.capacity)
+			}
+			if got := d.failed(&pubsub.Message{ID: tc.id}); got != tc.wantAttempts {
+				t.Errorf("failed(%s) = %d, want %d", tc.id, got, tc.wantAttempts)
+			}
+		})
+	}
+}
+
+func TestNewDeadLetterCapacity(t *testing.T) {
+	if d := newDeadLetter(nil, 5); d.capacity != maxDeadLetterAttempts {
+		t.Errorf("capacity = %d, want %d", d.capacity, maxDeadLetterAttempts)
+	}
+}
@@ -0,0 +1,94 @@
+package forwarder
+
+import (
+	"container/list"
+	"sync"
+	"time"
+
+	"cloud.google.com/go/pubsub"
+)
+
+// dedupCache remembers the keys of recently forwarded messages to drop their
+// duplicates. It is best-effort: it holds at most size keys for ttl each, in
+// memory, and duplicates received while the first copy is still being
+// published are not detected.
+type dedupCache struct {
+	attribute string
+	size      int
+	ttl       time.Duration
+
+	mu      sync.Mutex
+	entries map[string]*list.Element
+	// order lists the entries from the most to the least recently forwarded
+	order *list.List
+}
+
+type dedupEntry struct {
+	key string
+	at  time.Time
+}
+
+// newDedupCache creates a cache keyed by the attribute of messages, by their
+// ID when attribute is empty
+func newDedupCache(attribute string, size int, ttl time.Duration) *dedupCache {
+	return &dedupCache{
+		attribute: attribute,
+		size:      size,
+		ttl:       ttl,
+		entries:   map[string]*list.Element{},
+		order:     list.New(),
+	}
+}
+
+// key returns the deduplication key of msg, empty when the key attribute is
+// missing
+func (c *dedupCache) key(msg *pubsub.Message) string {
+	if c.attribute == "" {
+		return msg.ID
+	}
+	return msg.Attributes[c.attribute]
+}
+
+// seen reports whether a message with the key of msg was forwarded within
+// the window
+func (c *dedupCache) seen(msg *pubsub.Message) bool {
+	key := c.key(msg)
+	if key == "" {
+		return false
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	e, ok := c.entries[key]
+	if !ok {
+		return false
+	}
+	if time.Since(e.Value.(*dedupEntry).at) > c.ttl {
+		c.order.Remove(e)
+		delete(c.entries, key)
+		return false
+	}
+	return true
+}
+
+// add records that msg was forwarded, evicting the least recently forwarded
+// key when the cache is full
+func (c *dedupCache) add(msg *pubsub.Message) {
+	key := c.key(msg)
+	if key == "" {
+		return
+	}
+	now := time.Now()
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if e, ok := c.entries[key]; ok {
+		e.Value.(*dedupEntry).at = now
+		c.order.MoveToFront(e)
+		return
+	}
+	c.entries[key] = c.order.PushFront(&dedupEntry{key: key, at: now})
+	for c.order.Len() > c.size {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*dedupEntry).key)
+	}
+}
@@ -0,0 +1,66 @@
+package forwarder
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// minDrainCheckInterval and maxDrainCheckInterval bound the interval between
+// two idle checks
+const (
+	minDrainCheckInterval = 10 * time.Millisecond
+	maxDrainCheckInterval = time.Second
+)
+
+// activityTracker records when the forwarders last received a message,
+// shared by the forwarders and accessed atomically
+type activityTracker struct {
+	last int64
+}
+
+func newActivityTracker() *activityTracker {
+	t := &activityTracker{}
+	t.touch()
+	return t
+}
+
+// touch records that a message was received now
+func (t *activityTracker) touch() {
+	if t != nil {
+		atomic.StoreInt64(&t.last, time.Now().UnixNano())
+	}
+}
+
+// idleFor returns the time elapsed since the last message was received
+func (t *activityTracker) idleFor() time.Duration {
+	return time.Since(time.Unix(0, atomic.LoadInt64(&t.last)))
+}
+
+// watchDrain calls stop once no message was received for idle, the
+// subscriptions then being drained, or when ctx is done
+func watchDrain(ctx context.Context, t *activityTracker, idle time.Duration, stop func()) {
+	interval := idle / 10
+	if interval < minDrainCheckInterval {
+		interval = minDrainCheckInterval
+	}
+	if interval > maxDrainCheckInterval {
+		interval = maxDrainCheckInterval
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if t.idleFor() >= idle {
+				logrus.Infof("Subscriptions drained, no message received for %s", idle)
+				stop()
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,51 @@
+package forwarder
+
+import (
+	"github.com/sirupsen/logrus"
+)
+
+// DropReason is the machine-readable reason a message is not forwarded,
+// logged as the drop_reason field, stamped on dead-lettered messages and
+// labeling the messages_dropped_total metric
+type DropReason string
+
+// reasons of the messages acked without being forwarded, or dead-lettered
+const (
+	// DropReasonFiltered is a message not matching the attribute filter
+	DropReasonFiltered DropReason = "filtered"
+	// DropReasonDataUnmatched is a message whose data does not match the
+	// data regular expression
+	DropReasonDataUnmatched DropReason = "data_unmatched"
+	// DropReasonBeforeMinPublishTime is a message published before the min
+	// publish time
+	DropReasonBeforeMinPublishTime DropReason = "before_min_publish_time"
+	// DropReasonSampledOut is a message left out by the sampling
+	DropReasonSampledOut DropReason = "sampled_out"
+	// DropReasonMissingAttribute is a message without a required attribute
+	DropReasonMissingAttribute DropReason = "missing_attribute"
+	// DropReasonDuplicate is a message already forwarded
+	DropReasonDuplicate DropReason = "duplicate"
+	// DropReasonTranscodeFailed is a message whose data can not be transcoded
+	DropReasonTranscodeFailed DropReason = "transcode_failed"
+	// DropReasonEnvelopeFailed is a message the envelope template fails on
+	DropReasonEnvelopeFailed DropReason = "envelope_failed"
+	// DropReasonSchemaInvalid is a message not matching the schema
+	DropReasonSchemaInvalid DropReason = "schema_invalid"
+	// DropReasonOversized is a message exceeding the maximum message size
+	DropReasonOversized DropReason = "oversized"
+	// DropReasonRejected is a message the destination will never accept
+	DropReasonRejected DropReason = "rejected"
+	// DropReasonPublishFailed is a message whose publish failed, dropped by
+	// the ack mode or dead-lettered after the max retries
+	DropReasonPublishFailed DropReason = "publish_failed"
+)
+
+// logFieldDropReason is the log field of the drop reason
+const logFieldDropReason = "drop_reason"
+
+// dropped counts a message of f dropped for reason and returns log with the
+// reason field
+func (f *forwarder) dropped(log *logrus.Entry, reason DropReason) *logrus.Entry {
+	messagesDropped.WithLabelValues(append(f.labels(), string(reason))...).Inc()
+	return log.WithField(logFieldDropReason, reason)
+}
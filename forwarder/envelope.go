@@ -0,0 +1,67 @@
+package forwarder
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"text/template"
+	"time"
+
+	"cloud.google.com/go/pubsub"
+)
+
+// envelopeFuncs are the functions of envelope templates besides the builtin
+// ones, to embed values in JSON envelopes
+var envelopeFuncs = template.FuncMap{
+	// json encodes a value as JSON, e.g. a string as a quoted string
+	"json": func(v interface{}) (string, error) {
+		b, err := json.Marshal(v)
+		return string(b), err
+	},
+	// base64 encodes data with the standard encoding
+	"base64": func(data []byte) string {
+		return base64.StdEncoding.EncodeToString(data)
+	},
+}
+
+// envelope replaces the data of messages with the output of a Go template
+// wrapping it, e.g. with routing metadata
+type envelope struct {
+	tmpl *template.Template
+}
+
+// envelopeMessage is the message seen by envelope templates
+type envelopeMessage struct {
+	ID          string
+	Data        []byte
+	Text        string
+	Attributes  map[string]string
+	OrderingKey string
+	PublishTime time.Time
+}
+
+// newEnvelope parses text, failing on syntax errors
+func newEnvelope(text string) (*envelope, error) {
+	tmpl, err := template.New("envelope").Funcs(envelopeFuncs).Parse(text)
+	if err != nil {
+		return nil, err
+	}
+	return &envelope{tmpl: tmpl}, nil
+}
+
+// wrap returns the output of the template for msg
+func (e *envelope) wrap(msg *pubsub.Message) ([]byte, error) {
+	var buf bytes.Buffer
+	err := e.tmpl.Execute(&buf, envelopeMessage{
+		ID:          msg.ID,
+		Data:        msg.Data,
+		Text:        string(msg.Data),
+		Attributes:  msg.Attributes,
+		OrderingKey: msg.OrderingKey,
+		PublishTime: msg.PublishTime,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,79 @@
+package forwarder
+
+import (
+	"errors"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// ErrorKind is the category of an error returned by New or Run
+type ErrorKind int
+
+// error categories
+const (
+	// KindRuntime is a failure while forwarding messages
+	KindRuntime ErrorKind = iota
+	// KindConfig is an invalid configuration or a missing resource
+	KindConfig
+	// KindCredentials is a credential that can not be loaded or is not
+	// authorized
+	KindCredentials
+	// KindConnection is a failure to connect to pubsub or to a collector
+	KindConnection
+)
+
+func (k ErrorKind) String() string {
+	switch k {
+	case KindConfig:
+		return "config"
+	case KindCredentials:
+		return "credentials"
+	case KindConnection:
+		return "connection"
+	default:
+		return "runtime"
+	}
+}
+
+// Error is an error of a given kind
+type Error struct {
+	Kind ErrorKind
+	Err  error
+}
+
+func (e *Error) Error() string {
+	return e.Err.Error()
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// KindOf returns the kind of err, KindRuntime when it has none
+func KindOf(err error) ErrorKind {
+	var e *Error
+	if errors.As(err, &e) {
+		return e.Kind
+	}
+	return KindRuntime
+}
+
+// withKind returns err categorized as kind
+func withKind(kind ErrorKind, err error) error {
+	return &Error{Kind: kind, Err: err}
+}
+
+// receiveErrorKind returns the kind of an error stopping a receive loop,
+// permission and missing resource errors pointing to the configuration
+func receiveErrorKind(err error) ErrorKind {
+	for ; err != nil; err = errors.Unwrap(err) {
+		switch status.Code(err) {
+		case codes.PermissionDenied, codes.Unauthenticated:
+			return KindCredentials
+		case codes.NotFound, codes.InvalidArgument, codes.FailedPrecondition:
+			return KindConfig
+		}
+	}
+	return KindRuntime
+}
@@ -0,0 +1,178 @@
+package forwarder
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"cloud.google.com/go/pubsub"
+	"github.com/sirupsen/logrus"
+)
+
+// fileSyncInterval is the interval at which written messages are flushed to disk
+const fileSyncInterval = time.Second
+
+// fileRecord is the JSON line written for each message, data being encoded
+// in base64
+type fileRecord struct {
+	ID          string            `json:"id"`
+	Data        []byte            `json:"data"`
+	Attributes  map[string]string `json:"attributes,omitempty"`
+	OrderingKey string            `json:"ordering_key,omitempty"`
+	PublishTime time.Time         `json:"publish_time"`
+}
+
+// fileResult is the result of a message written to a file, known as soon as
+// it is written
+type fileResult struct {
+	err error
+}
+
+func (r fileResult) Get(context.Context) (string, error) {
+	return "", r.err
+}
+
+// filePublisher writes messages as JSON lines to a file shared by every
+// forwarder, rotating it once it reaches maxBytes when maxBytes is not 0
+type filePublisher struct {
+	path     string
+	maxBytes int64
+
+	mu   sync.Mutex
+	file *os.File
+	size int64
+	// refs is the number of forwarders writing to the file, it is closed
+	// when the last one stops
+	refs  int
+	dirty bool
+	done  chan struct{}
+}
+
+func newFilePublisher(path string, maxBytes int64) (*filePublisher, error) {
+	p := &filePublisher{path: path, maxBytes: maxBytes, done: make(chan struct{})}
+	if err := p.open(); err != nil {
+		return nil, err
+	}
+	go p.syncLoop()
+	return p, nil
+}
+
+// acquire returns the publisher for one more forwarder
+func (p *filePublisher) acquire() publisher {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.refs++
+	return p
+}
+
+func (p *filePublisher) Publish(_ context.Context, msg *pubsub.Message) publishResult {
+	line, err := json.Marshal(fileRecord{
+		ID:          msg.ID,
+		Data:        msg.Data,
+		Attributes:  msg.Attributes,
+		OrderingKey: msg.OrderingKey,
+		PublishTime: msg.PublishTime,
+	})
+	if err != nil {
+		return fileResult{err: err}
+	}
+	line = append(line, '\n')
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.file == nil {
+		return fileResult{err: fmt.Errorf("file %s is closed", p.path)}
+	}
+	if p.maxBytes > 0 && p.size > 0 && p.size+int64(len(line)) > p.maxBytes {
+		if err := p.rotate(); err != nil {
+			return fileResult{err: err}
+		}
+	}
+	n, err := p.file.Write(line)
+	p.size += int64(n)
+	p.dirty = true
+	return fileResult{err: err}
+}
+
+// Stop flushes and closes the file once every forwarder writing to it has
+// stopped
+func (p *filePublisher) Stop() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.refs--; p.refs > 0 || p.file == nil {
+		return
+	}
+	close(p.done)
+	if err := p.file.Sync(); err != nil {
+		logrus.Errorf("err when syncing file %s: %v", p.path, err)
+	}
+	if err := p.file.Close(); err != nil {
+		logrus.Errorf("err when closing file %s: %v", p.path, err)
+	}
+	p.file = nil
+}
+
+func (p *filePublisher) String() string {
+	return p.path
+}
+
+// open opens the file for appending, the caller holding the lock
+func (p *filePublisher) open() error {
+	file, err := os.OpenFile(p.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+	p.file = file
+	p.size = info.Size()
+	return nil
+}
+
+// rotate renames the full file with a timestamp suffix and opens a new one,
+// the caller holding the lock
+func (p *filePublisher) rotate() error {
+	if err := p.file.Sync(); err != nil {
+		return err
+	}
+	if err := p.file.Close(); err != nil {
+		return err
+	}
+	p.file = nil
+	rotated := fmt.Sprintf("%s.%s", p.path, time.Now().UTC().Format("20060102T150405.000000000"))
+	if err := os.Rename(p.path, rotated); err != nil {
+		if oerr := p.open(); oerr != nil {
+			return oerr
+		}
+		return err
+	}
+	logrus.Infof("Rotated file %s to %s", p.path, rotated)
+	return p.open()
+}
+
+// syncLoop flushes written messages to disk every fileSyncInterval
+func (p *filePublisher) syncLoop() {
+	ticker := time.NewTicker(fileSyncInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-p.done:
+			return
+		case <-ticker.C:
+		}
+		p.mu.Lock()
+		if p.file != nil && p.dirty {
+			if err := p.file.Sync(); err != nil {
+				logrus.Errorf("err when syncing file %s: %v", p.path, err)
+			}
+			p.dirty = false
+		}
+		p.mu.Unlock()
+	}
+}
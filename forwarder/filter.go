@@ -0,0 +1,37 @@
+package forwarder
+
+import "strings"
+
+// valueFilter matches messages whose attribute holds one of a set of values
+type valueFilter struct {
+	attribute       string
+	values          map[string]bool
+	caseInsensitive bool
+}
+
+func newValueFilter(attribute string, values []string, caseInsensitive bool) *valueFilter {
+	f := &valueFilter{
+		attribute:       attribute,
+		values:          make(map[string]bool, len(values)),
+		caseInsensitive: caseInsensitive,
+	}
+	for _, v := range values {
+		if caseInsensitive {
+			v = strings.ToLower(v)
+		}
+		f.values[v] = true
+	}
+	return f
+}
+
+// match reports whether attrs holds the attribute with one of the values
+func (f *valueFilter) match(attrs map[string]string) bool {
+	v, ok := attrs[f.attribute]
+	if !ok {
+		return false
+	}
+	if f.caseInsensitive {
+		v = strings.ToLower(v)
+	}
+	return f.values[v]
+}
@@ -0,0 +1,77 @@
+package forwarder
+
+import (
+	"sync/atomic"
+
+	"cloud.google.com/go/pubsub"
+)
+
+// flow control behaviors, deciding what happens to received messages once
+// max-outstanding-messages or max-outstanding-bytes is reached
+const (
+	// FlowControlBlock stops pulling messages until outstanding ones are
+	// handled, the behavior of the pubsub client
+	FlowControlBlock = "block"
+	// FlowControlIgnore does not enforce the limits
+	FlowControlIgnore = "ignore"
+	// FlowControlSignalError nacks the messages received beyond the limits
+	// for them to be redelivered
+	FlowControlSignalError = "signal-error"
+)
+
+// configureFlowControl applies the flow control limits and behavior to the
+// receive settings of sub and returns the limiter of the messages handled
+// by the forwarder, nil when the pubsub client enforces the limits or when
+// they are ignored
+func (cfg *Config) configureFlowControl(sub *pubsub.Subscription) *receiveLimiter {
+	switch cfg.FlowControlBehavior {
+	case FlowControlIgnore:
+		sub.ReceiveSettings.MaxOutstandingMessages = -1
+		sub.ReceiveSettings.MaxOutstandingBytes = -1
+		return nil
+	case FlowControlSignalError:
+		// the client would block before the limits are checked
+		sub.ReceiveSettings.MaxOutstandingMessages = -1
+		sub.ReceiveSettings.MaxOutstandingBytes = -1
+		return newReceiveLimiter(cfg.MaxOutstandingMessages, cfg.MaxOutstandingBytes)
+	default:
+		sub.ReceiveSettings.MaxOutstandingMessages = cfg.MaxOutstandingMessages
+		sub.ReceiveSettings.MaxOutstandingBytes = cfg.MaxOutstandingBytes
+		return nil
+	}
+}
+
+// receiveLimiter bounds the number and size of the messages being handled,
+// a limit of -1 being unlimited. With publish-async-ack, a message is
+// handled until it is queued for publishing.
+type receiveLimiter struct {
+	maxMessages, maxBytes int64
+	messages, bytes       int64
+}
+
+// newReceiveLimiter returns nil when both limits are unlimited
+func newReceiveLimiter(maxMessages, maxBytes int) *receiveLimiter {
+	if maxMessages < 0 && maxBytes < 0 {
+		return nil
+	}
+	return &receiveLimiter{maxMessages: int64(maxMessages), maxBytes: int64(maxBytes)}
+}
+
+// acquire counts a message of size bytes, unless it would exceed the
+// limits. A message larger than the byte limit is let through when no other
+// message is handled, as done by the pubsub client.
+func (l *receiveLimiter) acquire(size int) bool {
+	messages := atomic.AddInt64(&l.messages, 1)
+	bytes := atomic.AddInt64(&l.bytes, int64(size))
+	if (l.maxMessages >= 0 && messages > l.maxMessages) || (l.maxBytes >= 0 && bytes > l.maxBytes && messages > 1) {
+		l.release(size)
+		return false
+	}
+	return true
+}
+
+// release uncounts a message acquired with size bytes
+func (l *receiveLimiter) release(size int) {
+	atomic.AddInt64(&l.messages, -1)
+	atomic.AddInt64(&l.bytes, -int64(size))
+}
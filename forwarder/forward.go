@@ -0,0 +1,878 @@
+package forwarder
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"runtime/debug"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"cloud.google.com/go/pubsub"
+	"github.com/sirupsen/logrus"
+	"golang.org/x/time/rate"
+	"google.golang.org/api/option"
+)
+
+// Mapping binds a source subscription to a destination topic
+type Mapping struct {
+	PubSubSubscription     string `mapstructure:"pubsub-subscription"`
+	PubSubDestinationTopic string `mapstructure:"pubsub-destination-topic"`
+	FromGoogleCloudProject string `mapstructure:"from-google-cloud-project"`
+	ToGoogleCloudProject   string `mapstructure:"to-google-cloud-project"`
+	// PublishProfile is the publish profile of the destination topics, the
+	// global publish settings being used when empty
+	PublishProfile string `mapstructure:"publish-profile"`
+
+	// PubSubSourceTopic is only used by the setup command to create the subscription
+	PubSubSourceTopic string `mapstructure:"pubsub-source-topic"`
+}
+
+// DestinationTopics returns the topics of the mapping, PubSubDestinationTopic
+// being a comma separated list when messages are fanned out
+func (m Mapping) DestinationTopics() []string {
+	var topics []string
+	for _, t := range strings.Split(m.PubSubDestinationTopic, ",") {
+		if t = strings.TrimSpace(t); t != "" {
+			topics = append(topics, t)
+		}
+	}
+	return topics
+}
+
+// ClientPool shares one pubsub client per project for a set of client options
+type ClientPool struct {
+	opts    []option.ClientOption
+	clients map[string]*pubsub.Client
+	// fixed is the client used for every project when set, it is owned by
+	// the caller and not closed
+	fixed *pubsub.Client
+}
+
+func newClientPool(opts ...option.ClientOption) *ClientPool {
+	return &ClientPool{
+		opts:    opts,
+		clients: map[string]*pubsub.Client{},
+	}
+}
+
+// Get returns the client for the given project, creating it on first use
+func (p *ClientPool) Get(ctx context.Context, project string) (*pubsub.Client, error) {
+	if p.fixed != nil {
+		return p.fixed, nil
+	}
+	if client, ok := p.clients[project]; ok {
+		return client, nil
+	}
+	client, err := pubsub.NewClient(ctx, project, p.opts...)
+	if err != nil {
+		return nil, err
+	}
+	p.clients[project] = client
+	return client, nil
+}
+
+// fixedClientPool returns a pool always returning client
+func fixedClientPool(client *pubsub.Client) *ClientPool {
+	return &ClientPool{clients: map[string]*pubsub.Client{}, fixed: client}
+}
+
+// NewClientPools returns the pools of the source and destination clients of
+// cfg. When both sides share their credentials, they share a single pool so
+// that a project used by both sides has a single client.
+func NewClientPools(ctx context.Context, cfg Config) (from, to *ClientPool, err error) {
+	fromOpts, toOpts, err := cfg.clientOptions(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+	from, to = newClientPools(fromOpts, toOpts, cfg.sameCredentials())
+	return from, to, nil
+}
+
+func newClientPools(fromOpts, toOpts []option.ClientOption, shared bool) (from, to *ClientPool) {
+	from = newClientPool(fromOpts...)
+	if shared {
+		return from, from
+	}
+	return from, newClientPool(toOpts...)
+}
+
+// Close closes the clients of the pool, it can be called more than once
+func (p *ClientPool) Close() {
+	for project, client := range p.clients {
+		if err := client.Close(); err != nil {
+			logrus.Errorf("err when closing pubsub client for project %s: %v", project, err)
+		}
+	}
+	p.clients = map[string]*pubsub.Client{}
+}
+
+// log fields of the mapping of a message
+const (
+	logFieldSubscription     = "pubsub-subscription"
+	logFieldDestinationTopic = "pubsub-destination-topic"
+)
+
+// forwarder receives messages of one mapping and publishes them to its topic
+type forwarder struct {
+	mapping Mapping
+	sub     *pubsub.Subscription
+	// receiveLimit nacks the messages received beyond the flow control
+	// limits, nil when the pubsub client enforces them
+	receiveLimit *receiveLimiter
+	// topics is empty when dynamic routing has no default topic, every
+	// message is published to all of them otherwise
+	topics     []publisher
+	fanOutMode string
+	ackMode    string
+	router     *topicRouter
+	attributes attributeFilter
+	deadLetter *deadLetter
+	retry      retryPolicy
+	// publishTimeout bounds the wait for each publish, without limit when 0
+	publishTimeout time.Duration
+	// nackDelay delays the nacks, which are immediate when 0
+	nackDelay time.Duration
+	// receiveRetry retries receiving after transient errors, without limit
+	// when maxAttempts is 0
+	receiveRetry retryPolicy
+	transform    *celTransform
+	filter       *valueFilter
+	// dataMatch is matched against the data of messages, the ones not
+	// matching being acked without being published, nil without data filter
+	dataMatch *regexp.Regexp
+	// sampler drops the messages out of the sample, all of them being
+	// forwarded when nil
+	sampler *sampler
+	// minPublishTime drops the messages published before it, none when zero
+	minPublishTime time.Time
+	// orderingKeyAttribute is the received attribute giving the ordering
+	// key of forwarded messages, the received key being kept when empty
+	orderingKeyAttribute string
+	// ignoreOrdering drops the ordering key of forwarded messages
+	ignoreOrdering bool
+	// requiredAttributes are the attributes messages are rejected without
+	requiredAttributes []string
+	// missingAttributes counts the messages rejected for a missing
+	// attribute, accessed atomically
+	missingAttributes int64
+	// pause nacks messages while forwarding is paused
+	pause *pauseSwitch
+	// breaker nacks messages while the destination is failing, nil
+	// without circuit breaker
+	breaker *circuitBreaker
+	// activity records the received messages, nil without drain-idle
+	activity *activityTracker
+	// dedup drops messages already forwarded, without deduplication when nil
+	dedup *dedupCache
+	// transcode converts the forwarded data between serialization formats,
+	// the data being forwarded as is when nil
+	transcode *transcoder
+	// envelope wraps the forwarded data, the data being forwarded as is when
+	// nil
+	envelope *envelope
+	// schema validates the forwarded data, invalid messages being
+	// dead-lettered or dropped, without validation when nil
+	schema    schemaValidator
+	dryRun    bool
+	dryRunAck bool
+	asyncAck  bool
+	// decompressGzip and compressGzip decompress the received data and
+	// compress the forwarded data
+	decompressGzip bool
+	compressGzip   bool
+	// inject holds the attributes added to forwarded messages, with the
+	// forwarding time when injectForwardedAt is set
+	inject            map[string]string
+	injectForwardedAt bool
+	// publishTimeAttribute is the attribute the publish time of the received
+	// message is added as, none being added when empty
+	publishTimeAttribute string
+	// sequence counts the messages published by the forwarders, stamped on
+	// each of them, shared by the forwarders and nil without stamping
+	sequence *uint64
+	// credentials authenticate the source client, reloaded when the receive
+	// loop fails with an authentication error up to authRetries times in a
+	// row, nil with the emulator or injected clients
+	credentials *reloadableCredentials
+	authRetries int
+	// publishSlots bounds the publishes awaited at once, shared by the
+	// forwarders and without limit when nil
+	publishSlots chan struct{}
+	// budget bounds the messages and bytes forwarded by the run, shared by
+	// the forwarders and without limit when nil
+	budget *forwardBudget
+	// keySlots bounds the publishes awaited at once per ordering key,
+	// without limit when nil
+	keySlots *keySlots
+	// publishLimiter bounds the rate of publishes, shared by the forwarders
+	// and without limit when nil
+	publishLimiter *rate.Limiter
+	// maxMessageBytes is the size above which messages are not published,
+	// without limit when 0
+	maxMessageBytes int
+	// errorLog samples the per-message error logs, all of them being logged
+	// when nil
+	errorLog *errorSampler
+	// maxMessageAgeWarn is the age above which received messages are logged,
+	// never when 0
+	maxMessageAgeWarn time.Duration
+	// redeliveries detects the messages received again, nil when disabled
+	redeliveries *redeliveryTracker
+	// redeliveryWarn is the time since their first reception above which
+	// redelivered messages are logged, never when 0
+	redeliveryWarn time.Duration
+	// tracing starts a span around each publish
+	tracing bool
+	// panicFatal lets panics when handling a message crash the process
+	// instead of nacking the message
+	panicFatal bool
+
+	// pending tracks publishes awaited outside of the receive callback
+	pending sync.WaitGroup
+
+	// state is read by the readiness probe, accessed atomically
+	state int32
+}
+
+// receive forwards messages until ctx is done. Publishes use publishCtx so
+// that in-flight messages can complete after ctx has been cancelled.
+func (f *forwarder) receive(ctx, publishCtx context.Context) error {
+	for _, t := range f.topics {
+		defer t.Stop()
+	}
+	if f.router != nil {
+		defer f.router.stop()
+	}
+	if f.deadLetter != nil {
+		defer f.deadLetter.topic.Stop()
+	}
+	go func() {
+		if ok, err := f.sub.Exists(ctx); err == nil && ok {
+			atomic.CompareAndSwapInt32(&f.state, stateStarting, stateReady)
+		}
+	}()
+
+	defer f.pending.Wait()
+
+	log := logrus.
+		WithField(logFieldSubscription, f.mapping.PubSubSubscription).
+		WithField(logFieldDestinationTopic, f.mapping.PubSubDestinationTopic)
+
+	if f.errorLog != nil {
+		go f.errorLog.run(ctx, log)
+	}
+
+	authAttempt := 0
+	for attempt := 1; ; attempt++ {
+		var received int32
+		err := f.sub.Receive(ctx, func(_ context.Context, msg *pubsub.Message) {
+			atomic.StoreInt32(&received, 1)
+			if !f.panicFatal {
+				defer f.recoverPanic(publishCtx, log, msg)
+			}
+			if f.receiveLimit != nil {
+				size := len(msg.Data)
+				if !f.receiveLimit.acquire(size) {
+					messagesFlowControlled.WithLabelValues(f.labels()...).Inc()
+					log.WithField("message-id", msg.ID).Debug("Flow control limits exceeded, message nacked")
+					f.nack(publishCtx, msg)
+					return
+				}
+				defer f.receiveLimit.release(size)
+			}
+			f.handle(publishCtx, msg)
+		})
+		if err == nil || ctx.Err() != nil {
+			return nil
+		}
+
+		atomic.StoreInt32(&f.state, stateFailed)
+		// the receive loop worked before failing, count retries from scratch
+		if atomic.LoadInt32(&received) == 1 {
+			attempt = 1
+			authAttempt = 0
+		}
+		if isUnauthorized(err) && f.credentials != nil && authAttempt < f.authRetries {
+			authAttempt++
+			delay := f.receiveRetry.backoff.delay(authAttempt)
+			log.
+				WithField("attempt", authAttempt).
+				WithField("backoff", delay).
+				Warnf("err when receiving messages, reloading credentials and retrying: %v", err)
+			// the clients take their tokens from the reloaded credentials
+			if rerr := f.credentials.reload(ctx); rerr != nil {
+				log.Errorf("err when reloading credentials: %v", rerr)
+			}
+			if sleep(ctx, delay) != nil {
+				return nil
+			}
+			// retries with reloaded credentials are bounded on their own
+			attempt--
+			continue
+		}
+		if isPermanent(err) {
+			return err
+		}
+		if f.receiveRetry.maxAttempts > 0 && attempt > f.receiveRetry.maxAttempts {
+			return fmt.Errorf("giving up after %d retries: %w", f.receiveRetry.maxAttempts, err)
+		}
+
+		delay := f.receiveRetry.backoff.delay(attempt)
+		log.
+			WithField("attempt", attempt).
+			WithField("backoff", delay).
+			Warnf("err when receiving messages, retrying: %v", err)
+		if sleep(ctx, delay) != nil {
+			return nil
+		}
+	}
+}
+
+// recoverPanic recovers from a panic when handling msg, which is nacked so
+// that it is not lost, to be deferred by the receive callback
+func (f *forwarder) recoverPanic(ctx context.Context, log *logrus.Entry, msg *pubsub.Message) {
+	r := recover()
+	if r == nil {
+		return
+	}
+	callbackPanics.WithLabelValues(f.labels()...).Inc()
+	log.
+		WithField("message-id", msg.ID).
+		WithField("stack", string(debug.Stack())).
+		Errorf("panic when handling message, message nacked: %v", r)
+	f.nack(ctx, msg)
+}
+
+// handle forwards one received message and acks or nacks it
+func (f *forwarder) handle(ctx context.Context, msg *pubsub.Message) {
+	if atomic.LoadInt32(&f.state) != stateReady {
+		atomic.StoreInt32(&f.state, stateReady)
+	}
+	f.activity.touch()
+	labels := f.labels()
+	messagesReceived.WithLabelValues(labels...).Inc()
+
+	log := logrus.WithFields(logrus.Fields{
+		logFieldSubscription:     f.mapping.PubSubSubscription,
+		logFieldDestinationTopic: f.mapping.PubSubDestinationTopic,
+		"message-id":             msg.ID,
+	})
+
+	if !msg.PublishTime.IsZero() {
+		age := time.Since(msg.PublishTime)
+		messageAge.WithLabelValues(labels...).Observe(age.Seconds())
+		if f.maxMessageAgeWarn > 0 && age > f.maxMessageAgeWarn {
+			log.WithField("age", age).Warnf("Message is older than %s, the forwarder is falling behind", f.maxMessageAgeWarn)
+		}
+	}
+
+	if f.redeliveries != nil {
+		if redelivered, interval, deliveries := f.redeliveries.observe(msg.ID); redelivered {
+			messagesRedelivered.WithLabelValues(labels...).Inc()
+			redeliveryInterval.WithLabelValues(labels...).Observe(interval.Seconds())
+			if f.redeliveryWarn > 0 && interval > f.redeliveryWarn {
+				log.
+					WithField("interval", interval).
+					WithField("deliveries", deliveries).
+					Warnf("Message redelivered more than %s after it was first received", f.redeliveryWarn)
+			}
+		}
+	}
+
+	if f.pause.isPaused() {
+		log.Debug("Forwarding paused, message nacked")
+		f.nack(ctx, msg)
+		return
+	}
+
+	if !f.breaker.allow() {
+		log.Debug("Circuit open, message nacked")
+		f.nack(ctx, msg)
+		return
+	}
+
+	if f.filter != nil && !f.filter.match(msg.Attributes) {
+		messagesFiltered.WithLabelValues(labels...).Inc()
+		f.dropped(log, DropReasonFiltered).Debug("Message filtered out")
+		msg.Ack()
+		return
+	}
+
+	if !f.minPublishTime.IsZero() && msg.PublishTime.Before(f.minPublishTime) {
+		messagesBeforeMinPublishTime.WithLabelValues(labels...).Inc()
+		f.dropped(log, DropReasonBeforeMinPublishTime).WithField("publish-time", msg.PublishTime).Debug("Message published before the min publish time dropped")
+		msg.Ack()
+		return
+	}
+
+	if f.sampler != nil && !f.sampler.keep(msg) {
+		messagesSampledOut.WithLabelValues(labels...).Inc()
+		f.dropped(log, DropReasonSampledOut).Debug("Message sampled out")
+		msg.Ack()
+		return
+	}
+
+	if missing := missingAttribute(msg.Attributes, f.requiredAttributes); missing != "" {
+		messagesMissingAttributes.WithLabelValues(labels...).Inc()
+		// only the first rejections are logged, the next ones being
+		// counted by the metric
+		level := logrus.DebugLevel
+		if atomic.AddInt64(&f.missingAttributes, 1) <= missingAttributesLogged {
+			level = logrus.WarnLevel
+		}
+		f.rejectAt(ctx, log, level, msg, DropReasonMissingAttribute, fmt.Errorf("message has no required %s attribute", missing))
+		return
+	}
+
+	if f.dedup != nil && f.dedup.seen(msg) {
+		duplicatesDropped.WithLabelValues(labels...).Inc()
+		f.dropped(log, DropReasonDuplicate).Info("Duplicate message dropped")
+		msg.Ack()
+		return
+	}
+
+	// ID and PublishTime are not sent by publishers, they are kept for the
+	// file destination
+	out := &pubsub.Message{
+		ID:          msg.ID,
+		Data:        msg.Data,
+		Attributes:  f.attributes.apply(msg.Attributes),
+		OrderingKey: msg.OrderingKey,
+		PublishTime: msg.PublishTime,
+	}
+	if f.orderingKeyAttribute != "" {
+		// messages without the attribute are published unordered
+		out.OrderingKey = msg.Attributes[f.orderingKeyAttribute]
+	}
+	if f.ignoreOrdering {
+		out.OrderingKey = ""
+	}
+
+	if f.decompressGzip {
+		data, err := gunzip(out.Data)
+		if err != nil {
+			decompressFailures.WithLabelValues(labels...).Inc()
+			f.errorf(log, "err when decompressing message: %v", err)
+			f.nack(ctx, msg)
+			return
+		}
+		out.Data = data
+		delete(out.Attributes, contentEncodingAttribute)
+	}
+
+	if f.dataMatch != nil && !f.dataMatch.Match(out.Data) {
+		messagesDataUnmatched.WithLabelValues(labels...).Inc()
+		f.dropped(log, DropReasonDataUnmatched).Debug("Message data does not match, message filtered out")
+		msg.Ack()
+		return
+	}
+
+	if f.transform != nil {
+		if err := f.transform.apply(out); err != nil {
+			transformFailures.WithLabelValues(labels...).Inc()
+			f.errorf(log, "err when transforming message: %v", err)
+			f.nack(ctx, msg)
+			return
+		}
+	}
+
+	if f.transcode != nil {
+		data, err := f.transcode.transcode(out.Data)
+		if err != nil {
+			transcodeFailures.WithLabelValues(labels...).Inc()
+			cause := fmt.Errorf("err when transcoding message: %w", err)
+			if f.deadLetter != nil {
+				f.reject(ctx, log, msg, DropReasonTranscodeFailed, cause)
+				return
+			}
+			f.errorf(log, "%v", cause)
+			f.nack(ctx, msg)
+			return
+		}
+		out.Data = data
+	}
+
+	if f.envelope != nil {
+		data, err := f.envelope.wrap(out)
+		if err != nil {
+			envelopeFailures.WithLabelValues(labels...).Inc()
+			cause := fmt.Errorf("err when wrapping message in envelope: %w", err)
+			if f.deadLetter != nil {
+				f.reject(ctx, log, msg, DropReasonEnvelopeFailed, cause)
+				return
+			}
+			f.errorf(log, "%v", cause)
+			f.nack(ctx, msg)
+			return
+		}
+		out.Data = data
+	}
+
+	if f.schema != nil {
+		if err := f.schema.validate(out.Data); err != nil {
+			messagesInvalid.WithLabelValues(labels...).Inc()
+			f.reject(ctx, log, msg, DropReasonSchemaInvalid, fmt.Errorf("message does not match the schema: %w", err))
+			return
+		}
+	}
+
+	if f.compressGzip {
+		data, err := gzipData(out.Data)
+		if err != nil {
+			f.errorf(log, "err when compressing message: %v", err)
+			f.nack(ctx, msg)
+			return
+		}
+		out.Data = data
+		if out.Attributes == nil {
+			out.Attributes = map[string]string{}
+		}
+		out.Attributes[contentEncodingAttribute] = contentEncodingGzip
+	}
+
+	if len(f.inject) > 0 || f.injectForwardedAt || f.publishTimeAttribute != "" {
+		if out.Attributes == nil {
+			out.Attributes = make(map[string]string, len(f.inject)+2)
+		}
+		for k, v := range f.inject {
+			out.Attributes[k] = v
+		}
+		if f.injectForwardedAt {
+			out.Attributes[forwardedAtAttribute] = time.Now().UTC().Format(time.RFC3339)
+		}
+		// the publish time set by the server of the source topic, the
+		// destination setting its own, to the nanosecond for latencies
+		if f.publishTimeAttribute != "" && !msg.PublishTime.IsZero() {
+			out.Attributes[f.publishTimeAttribute] = msg.PublishTime.UTC().Format(time.RFC3339Nano)
+		}
+	}
+
+	log = log.WithField("size", len(out.Data))
+
+	if f.maxMessageBytes > 0 && len(out.Data) > f.maxMessageBytes {
+		messagesOversized.WithLabelValues(labels...).Inc()
+		f.reject(ctx, log, msg, DropReasonOversized, fmt.Errorf("message of %d bytes exceeds the maximum of %d bytes", len(out.Data), f.maxMessageBytes))
+		return
+	}
+
+	if f.dryRun {
+		log.WithField("attributes", out.Attributes).Info("Dry run, message not published")
+		if f.dryRunAck {
+			msg.Ack()
+		} else {
+			f.nack(ctx, msg)
+		}
+		return
+	}
+
+	topics := f.topics
+	if f.router != nil {
+		// the received attributes, the mapping may rename or drop the
+		// routing attribute
+		if t, ok := f.router.route(msg.Attributes); ok {
+			topics = []publisher{topicPublisher{t}}
+			log = log.WithField("routed-topic", t.ID())
+		}
+	}
+	if len(topics) == 0 {
+		log.Errorf("Message has no %s attribute and no default topic is set", f.router.attribute)
+		f.nack(ctx, msg)
+		return
+	}
+
+	if f.publishLimiter != nil {
+		// one token per publish, a shutdown stops the wait
+		for range topics {
+			if err := f.publishLimiter.Wait(ctx); err != nil {
+				log.Debugf("Rate limit wait interrupted, message nacked: %v", err)
+				f.nack(ctx, msg)
+				return
+			}
+		}
+	}
+
+	// holding the callback delays the next pulls while the key is slow
+	if err := f.keySlots.acquire(ctx, out.OrderingKey); err != nil {
+		f.nack(ctx, msg)
+		return
+	}
+
+	if f.publishSlots != nil {
+		select {
+		case f.publishSlots <- struct{}{}:
+		case <-ctx.Done():
+			f.keySlots.release(out.OrderingKey)
+			f.nack(ctx, msg)
+			return
+		}
+	}
+
+	if !f.budget.take(len(out.Data)) {
+		log.Debug("Max messages or bytes reached, message nacked")
+		f.releasePublishSlot(out.OrderingKey)
+		f.nack(ctx, msg)
+		return
+	}
+
+	if f.sequence != nil {
+		// taken last so that the sequence follows the publish order
+		if out.Attributes == nil {
+			out.Attributes = make(map[string]string, 1)
+		}
+		out.Attributes[forwardSeqAttribute] = strconv.FormatUint(atomic.AddUint64(f.sequence, 1), 10)
+	}
+
+	if f.tracing {
+		ctx, _ = f.startSpan(ctx, msg, out)
+	}
+
+	if f.ackMode == AckModeBeforePublish {
+		msg.Ack()
+	}
+
+	start := time.Now()
+	results := make([]publishResult, len(topics))
+	for i, t := range topics {
+		results[i] = t.Publish(ctx, out)
+	}
+	if !f.asyncAck {
+		f.complete(ctx, log, topics, msg, out, results, start)
+		f.releasePublishSlot(out.OrderingKey)
+		return
+	}
+
+	// the message is queued for publishing in the callback so that ordering
+	// is preserved, only the wait for the server confirmation is detached
+	f.pending.Add(1)
+	go func() {
+		defer f.pending.Done()
+		defer f.releasePublishSlot(out.OrderingKey)
+		f.complete(ctx, log, topics, msg, out, results, start)
+	}()
+}
+
+// complete waits for the publishes of out, the forwarded copy of msg, to be
+// confirmed by the servers of topics and acks or nacks msg according to the
+// fan-out mode
+func (f *forwarder) complete(ctx context.Context, log *logrus.Entry, topics []publisher, msg, out *pubsub.Message, results []publishResult, start time.Time) {
+	labels := f.labels()
+	var (
+		err       error
+		published int
+	)
+	for i, t := range topics {
+		perr := f.wait(ctx, log, t, out, results[i])
+		if perr == nil {
+			published++
+			continue
+		}
+		if len(topics) > 1 {
+			perr = fmt.Errorf("topic %s: %w", t, perr)
+		}
+		if err == nil {
+			err = perr
+		}
+		// the message is redelivered or dead-lettered, later messages of its
+		// ordering key must not stay blocked behind it
+		resumePublish(t, out.OrderingKey)
+	}
+	if published > 0 && f.fanOutMode == FanOutModeAny {
+		if err != nil {
+			log.Warnf("Message published to %d of %d topics: %v", published, len(topics), err)
+		}
+		err = nil
+	}
+	endSpan(ctx, err)
+	latency := time.Since(start)
+	publishLatency.WithLabelValues(labels...).Observe(latency.Seconds())
+	log = log.WithField("latency", latency)
+
+	if err == nil {
+		f.breaker.success()
+		f.budget.spend(len(out.Data))
+		messagesPublished.WithLabelValues(labels...).Inc()
+		if f.deadLetter != nil {
+			f.deadLetter.forget(msg)
+		}
+		if f.dedup != nil {
+			f.dedup.add(msg)
+		}
+		log.Debug("Message forwarded")
+		msg.Ack()
+		return
+	}
+
+	f.budget.giveBack(len(out.Data))
+
+	// publishes cancelled by the shutdown are not failures, the message is
+	// redelivered after the restart unless it was already acked
+	if ctx.Err() != nil && f.ackMode != AckModeBeforePublish {
+		log.Debugf("Publish cancelled by shutdown, message nacked: %v", err)
+		f.nack(ctx, msg)
+		return
+	}
+
+	publishFailures.WithLabelValues(labels...).Inc()
+
+	// messages the destination can never accept are not retried
+	var rejected *rejectedError
+	if errors.As(err, &rejected) {
+		f.reject(ctx, log, msg, DropReasonRejected, err)
+		return
+	}
+
+	f.breaker.failure()
+	f.errorf(log, "err when inserting data: %v", err)
+
+	switch f.ackMode {
+	case AckModeBeforePublish:
+		f.dropped(log, DropReasonPublishFailed).Warn("Message dropped, it was acked before publishing")
+		return
+	case AckModeAlways:
+		f.dropped(log, DropReasonPublishFailed).Warn("Message dropped, acked whatever the publish outcome")
+		msg.Ack()
+		return
+	}
+
+	if f.deadLetter != nil {
+		if attempts := f.deadLetter.failed(msg); attempts >= f.deadLetter.maxRetries {
+			dlErr := f.deadLetter.publish(ctx, f.mapping.PubSubSubscription, msg, attempts, DropReasonPublishFailed, err)
+			if dlErr == nil {
+				messagesDeadLettered.WithLabelValues(labels...).Inc()
+				f.dropped(log, DropReasonPublishFailed).WithField("attempts", attempts).Warn("Message sent to dead-letter topic")
+				msg.Ack()
+				return
+			}
+			log.Errorf("err when publishing to dead-letter topic: %v", dlErr)
+		}
+	}
+
+	f.nack(ctx, msg)
+}
+
+// reject dead-letters msg, which can not be published for cause, e.g. as it
+// exceeds the maximum message size, or drops it when no dead-letter topic is
+// set, reporting reason. The publish would fail on every redelivery otherwise.
+func (f *forwarder) reject(ctx context.Context, log *logrus.Entry, msg *pubsub.Message, reason DropReason, cause error) {
+	f.rejectAt(ctx, log, logrus.WarnLevel, msg, reason, cause)
+}
+
+// rejectAt rejects msg as reject does, logging the rejection at level
+func (f *forwarder) rejectAt(ctx context.Context, log *logrus.Entry, level logrus.Level, msg *pubsub.Message, reason DropReason, cause error) {
+	labels := f.labels()
+
+	if f.deadLetter == nil {
+		f.dropped(log, reason).Logf(level, "Message dropped: %v", cause)
+		msg.Ack()
+		return
+	}
+	if err := f.deadLetter.publish(ctx, f.mapping.PubSubSubscription, msg, 0, reason, cause); err != nil {
+		log.Errorf("err when publishing to dead-letter topic: %v", err)
+		f.nack(ctx, msg)
+		return
+	}
+	messagesDeadLettered.WithLabelValues(labels...).Inc()
+	f.dropped(log, reason).Logf(level, "Message sent to dead-letter topic: %v", cause)
+	msg.Ack()
+}
+
+// wait waits for the publish result of msg, publishing it again on failure
+// with an exponential backoff as configured by the retry policy
+func (f *forwarder) wait(ctx context.Context, log *logrus.Entry, topic publisher, msg *pubsub.Message, res publishResult) error {
+	for attempt := 1; ; attempt++ {
+		_, err := f.get(ctx, res)
+		if err == nil || attempt >= f.retry.maxAttempts || ctx.Err() != nil {
+			return err
+		}
+
+		delay := f.retry.backoff.delay(attempt)
+		log.
+			WithField("attempt", attempt).
+			WithField("backoff", delay).
+			Debugf("err when publishing, retrying: %v", err)
+		if serr := sleep(ctx, delay); serr != nil {
+			return err
+		}
+		resumePublish(topic, msg.OrderingKey)
+		res = topic.Publish(ctx, msg)
+	}
+}
+
+// get waits for res up to the publish timeout, a hung publish failing
+// instead of holding its receive slot forever
+func (f *forwarder) get(ctx context.Context, res publishResult) (string, error) {
+	if f.publishTimeout <= 0 {
+		return res.Get(ctx)
+	}
+	ctx, cancel := context.WithTimeout(ctx, f.publishTimeout)
+	defer cancel()
+	id, err := res.Get(ctx)
+	if errors.Is(err, context.DeadlineExceeded) {
+		err = fmt.Errorf("publish not confirmed within %s: %w", f.publishTimeout, err)
+	}
+	return id, err
+}
+
+// nack nacks msg once the nack delay elapsed, so that a failing message is
+// not redelivered right away. The delay is cut short when ctx is done.
+func (f *forwarder) nack(ctx context.Context, msg *pubsub.Message) {
+	messagesNacked.WithLabelValues(f.labels()...).Inc()
+	if f.nackDelay > 0 {
+		_ = sleep(ctx, f.nackDelay)
+	}
+	msg.Nack()
+}
+
+// errorf logs a per-message error, unless it is sampled out
+func (f *forwarder) errorf(log *logrus.Entry, format string, args ...interface{}) {
+	if f.errorLog != nil && !f.errorLog.allow() {
+		return
+	}
+	log.Errorf(format, args...)
+}
+
+// releasePublishSlot frees the publish slot and the slot of the ordering
+// key taken by handle
+func (f *forwarder) releasePublishSlot(key string) {
+	if f.publishSlots != nil {
+		<-f.publishSlots
+	}
+	f.keySlots.release(key)
+}
+
+// labels returns the metric labels of the forwarder
+func (f *forwarder) labels() []string {
+	return []string{f.mapping.PubSubSubscription, f.mapping.PubSubDestinationTopic}
+}
+
+// receiveAll runs every forwarder until ctx is done. A forwarder that fails
+// does not stop the others; the errors of failed forwarders are returned.
+func receiveAll(ctx, publishCtx context.Context, forwarders []*forwarder) []error {
+	var (
+		wg     sync.WaitGroup
+		mu     sync.Mutex
+		failed []error
+	)
+	for _, f := range forwarders {
+		wg.Add(1)
+		go func(f *forwarder) {
+			defer wg.Done()
+			if err := f.receive(ctx, publishCtx); err != nil {
+				logrus.
+					WithField(logFieldSubscription, f.mapping.PubSubSubscription).
+					WithField(logFieldDestinationTopic, f.mapping.PubSubDestinationTopic).
+					Errorf("err when receiving messages: %v", err)
+				mu.Lock()
+				failed = append(failed, err)
+				mu.Unlock()
+			}
+		}(f)
+	}
+	wg.Wait()
+	return failed
+}
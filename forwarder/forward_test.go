@@ -0,0 +1,62 @@
+package forwarder
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"cloud.google.com/go/pubsub"
+)
+
+// serviceAccount returns the JSON credentials of a fake service account,
+// only parsed as no request is sent
+func serviceAccount(email string) string {
+	return fmt.Sprintf(`{"type":"service_account","project_id":"p","private_key_id":"k","private_key":"","client_email":%q,"client_id":"1","token_uri":"https://oauth2.googleapis.com/token"}`, email)
+}
+
+func TestNewClientPools(t *testing.T) {
+	for _, tc := range []struct {
+		name           string
+		from, to       string
+		fromProject    string
+		toProject      string
+		wantShared     bool
+		wantNumClients int
+	}{
+		{name: "same credentials and project", from: serviceAccount("a@p.iam.gserviceaccount.com"), to: serviceAccount("a@p.iam.gserviceaccount.com"), fromProject: "p", toProject: "p", wantShared: true, wantNumClients: 1},
+		{name: "same credentials and other project", from: serviceAccount("a@p.iam.gserviceaccount.com"), to: serviceAccount("a@p.iam.gserviceaccount.com"), fromProject: "p", toProject: "q", wantNumClients: 2},
+		{name: "other credentials", from: serviceAccount("a@p.iam.gserviceaccount.com"), to: serviceAccount("b@p.iam.gserviceaccount.com"), fromProject: "p", toProject: "p", wantNumClients: 2},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			ctx := context.Background()
+			from, to, err := NewClientPools(ctx, Config{FromGoogleApplicationCredentials: tc.from, ToGoogleApplicationCredentials: tc.to})
+			if err != nil {
+				t.Fatalf("NewClientPools() error = %v", err)
+			}
+			defer from.Close()
+			defer to.Close()
+
+			fromClient, err := from.Get(ctx, tc.fromProject)
+			if err != nil {
+				t.Fatalf("from.Get() error = %v", err)
+			}
+			toClient, err := to.Get(ctx, tc.toProject)
+			if err != nil {
+				t.Fatalf("to.Get() error = %v", err)
+			}
+
+			if shared := fromClient == toClient; shared != tc.wantShared {
+				t.Errorf("source and destination share their client = %t, want %t", shared, tc.wantShared)
+			}
+			clients := map[*pubsub.Client]bool{}
+			for _, p := range []*ClientPool{from, to} {
+				for _, c := range p.clients {
+					clients[c] = true
+				}
+			}
+			if len(clients) != tc.wantNumClients {
+				t.Errorf("%d clients built, want %d", len(clients), tc.wantNumClients)
+			}
+		})
+	}
+}
@@ -0,0 +1,643 @@
+package forwarder
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"cloud.google.com/go/pubsub"
+	"github.com/segmentio/kafka-go"
+	"github.com/sirupsen/logrus"
+	"golang.org/x/time/rate"
+	"google.golang.org/api/option"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/keepalive"
+)
+
+// deletedTopic is the topic ID of subscriptions whose topic was deleted
+const deletedTopic = "_deleted-topic_"
+
+// receiveBackoffInitial is the delay before the first retry of a failed receive
+const receiveBackoffInitial = time.Second
+
+// defaultGRPCKeepaliveTime is the keepalive time set by the pubsub client
+// library, used when only the keepalive timeout is set
+const defaultGRPCKeepaliveTime = 5 * time.Minute
+
+// Forwarder forwards the messages of every mapping of its configuration
+type Forwarder struct {
+	cfg         Config
+	fromClients *ClientPool
+	toClients   *ClientPool
+	forwarders  []*forwarder
+	pause       *pauseSwitch
+	// budget bounds the messages and bytes forwarded by the run
+	budget *forwardBudget
+	// activity tracks the received messages to detect drained
+	// subscriptions, nil without drain-idle
+	activity *activityTracker
+	// monitoringOpts are the options of the Monitoring API client querying
+	// the subscription backlogs, nil when it is not reachable, e.g. with the
+	// emulator or injected clients
+	monitoringOpts []option.ClientOption
+	// credentials are the distinct credentials of the clients, reloaded by
+	// ReloadCredentials, nil with the emulator or injected clients
+	credentials []*reloadableCredentials
+	// http serves the metrics, health and admin endpoints during runs
+	http *httpServers
+}
+
+// New creates the forwarder of cfg, connecting to the source subscriptions
+// and destination topics of its mappings
+func New(cfg Config) (*Forwarder, error) {
+	if problems := cfg.Validate(); len(problems) > 0 {
+		return nil, withKind(KindConfig, fmt.Errorf("invalid configuration: %s", strings.Join(problems, " ")))
+	}
+	ctx := context.Background()
+
+	steps, err := cfg.pipeline()
+	if err != nil {
+		return nil, err
+	}
+
+	fromCreds, toCreds, err := cfg.clientCredentials(ctx)
+	if err != nil {
+		return nil, err
+	}
+	fromOpts, toOpts, err := cfg.clientOptionsWith(fromCreds, toCreds)
+	if err != nil {
+		return nil, err
+	}
+	fromClients, toClients := newClientPools(fromOpts, toOpts, cfg.sameCredentials())
+	fw, err := newForwarder(ctx, cfg, fromClients, toClients, toOpts, steps)
+	if err != nil {
+		return nil, err
+	}
+	if fromCreds != nil {
+		fw.monitoringOpts = append([]option.ClientOption{fromCreds.option()}, cfg.keepaliveOptions()...)
+		fw.credentials = []*reloadableCredentials{fromCreds}
+		if toCreds != fromCreds {
+			fw.credentials = append(fw.credentials, toCreds)
+		}
+		for _, f := range fw.forwarders {
+			f.credentials = fromCreds
+		}
+	}
+	return fw, nil
+}
+
+// NewWithClients creates the forwarder of cfg using the given source and
+// destination clients for every mapping, whatever their projects, e.g. to
+// connect to an emulator in tests. The clients are not closed by Run.
+// Pubsub lite and bigquery destinations are not supported as they do not use
+// pubsub clients.
+func NewWithClients(from, to *pubsub.Client, cfg Config) (*Forwarder, error) {
+	if problems := cfg.Validate(); len(problems) > 0 {
+		return nil, withKind(KindConfig, fmt.Errorf("invalid configuration: %s", strings.Join(problems, " ")))
+	}
+	if cfg.DestinationType == DestinationTypePubSubLite || cfg.DestinationType == DestinationTypeBigQuery {
+		return nil, withKind(KindConfig, fmt.Errorf("%s destinations can not be used with injected clients", cfg.DestinationType))
+	}
+	steps, err := cfg.pipeline()
+	if err != nil {
+		return nil, err
+	}
+	return newForwarder(context.Background(), cfg, fixedClientPool(from), fixedClientPool(to), nil, steps)
+}
+
+// pipeline holds the message processing steps shared by the mappings
+type pipeline struct {
+	filter    *valueFilter
+	dataMatch *regexp.Regexp
+	transform *celTransform
+	transcode *transcoder
+	envelope  *envelope
+	schema    schemaValidator
+	inject    map[string]string
+	rename    map[string]string
+}
+
+// pipeline returns the message processing steps of cfg
+func (cfg *Config) pipeline() (pipeline, error) {
+	var steps pipeline
+	if cfg.FilterAttribute != "" {
+		steps.filter = newValueFilter(cfg.FilterAttribute, cfg.FilterValues, cfg.FilterCaseInsensitive)
+	}
+
+	if cfg.DataMatchRegex != "" {
+		re, err := regexp.Compile(cfg.DataMatchRegex)
+		if err != nil {
+			return steps, withKind(KindConfig, fmt.Errorf("could not compile data match regex: %w", err))
+		}
+		steps.dataMatch = re
+	}
+
+	if cfg.TransformCEL != "" {
+		t, err := newCELTransform(cfg.TransformCEL)
+		if err != nil {
+			return steps, withKind(KindConfig, fmt.Errorf("could not compile transform: %w", err))
+		}
+		steps.transform = t
+	}
+
+	if cfg.InputCodec != "" {
+		t, err := newTranscoder(*cfg)
+		if err != nil {
+			return steps, withKind(KindConfig, fmt.Errorf("could not create codecs: %w", err))
+		}
+		steps.transcode = t
+	}
+
+	if cfg.EnvelopeTemplate != "" {
+		e, err := newEnvelope(cfg.EnvelopeTemplate)
+		if err != nil {
+			return steps, withKind(KindConfig, fmt.Errorf("could not parse envelope template: %w", err))
+		}
+		steps.envelope = e
+	}
+
+	if cfg.ValidateSchema {
+		v, err := newSchemaValidator(cfg.SchemaFile, cfg.SchemaEncoding)
+		if err != nil {
+			return steps, withKind(KindConfig, fmt.Errorf("could not load schema %s: %w", cfg.SchemaFile, err))
+		}
+		steps.schema = v
+	}
+
+	inject, err := parseAttributes(cfg.InjectAttributes)
+	if err != nil {
+		return steps, withKind(KindConfig, fmt.Errorf("could not parse injected attributes: %w", err))
+	}
+	steps.inject = inject
+
+	rename, err := parseAttributeMapping(cfg.AttributeMapping)
+	if err != nil {
+		return steps, withKind(KindConfig, fmt.Errorf("could not parse attribute mapping: %w", err))
+	}
+	steps.rename = rename
+	return steps, nil
+}
+
+// newForwarder creates the forwarders of the mappings of cfg with the given
+// clients, toOpts being the client options of pubsub lite publishers
+func newForwarder(ctx context.Context, cfg Config, fromClients, toClients *ClientPool, toOpts []option.ClientOption, steps pipeline) (*Forwarder, error) {
+	fw := &Forwarder{
+		cfg:         cfg,
+		fromClients: fromClients,
+		toClients:   toClients,
+		forwarders:  make([]*forwarder, 0, len(cfg.Mappings)),
+		pause:       &pauseSwitch{},
+	}
+	if cfg.DrainIdle > 0 {
+		fw.activity = newActivityTracker()
+	}
+	fw.budget = newForwardBudget(cfg.MaxMessages, cfg.MaxBytes)
+	var sequence *uint64
+	if cfg.StampSequence {
+		sequence = new(uint64)
+	}
+
+	var publishSlots chan struct{}
+	if cfg.PublishConcurrency > 0 {
+		publishSlots = make(chan struct{}, cfg.PublishConcurrency)
+	}
+	var publishLimiter *rate.Limiter
+	if cfg.MaxPublishRate > 0 {
+		publishLimiter = rate.NewLimiter(rate.Limit(cfg.MaxPublishRate), cfg.PublishBurst)
+	}
+	var httpTLS *tls.Config
+	if cfg.AdminTLSCert != "" {
+		var err error
+		if httpTLS, err = serverTLSConfig(cfg.AdminTLSCert, cfg.AdminTLSKey); err != nil {
+			return nil, withKind(KindConfig, fmt.Errorf("could not load admin TLS certificate %s: %w", cfg.AdminTLSCert, err))
+		}
+	}
+	fw.http = newHTTPServers(httpTLS)
+	var fileSink *filePublisher
+	if cfg.DestinationType == DestinationTypeFile {
+		var err error
+		if fileSink, err = newFilePublisher(cfg.DestinationFile, int64(cfg.DestinationFileMaxBytes)); err != nil {
+			return nil, withKind(KindConfig, fmt.Errorf("could not open destination file %s: %w", cfg.DestinationFile, err))
+		}
+	}
+	var tableSink *bigQueryPublisher
+	if cfg.DestinationType == DestinationTypeBigQuery {
+		project := cfg.BigQueryProject
+		if project == "" {
+			project = cfg.Mappings[0].DestinationProject()
+		}
+		var err error
+		if tableSink, err = newBigQueryPublisher(ctx, project, cfg.BigQueryDataset, cfg.BigQueryTable, cfg.BigQueryFlushInterval, toOpts...); err != nil {
+			return nil, withKind(KindConnection, fmt.Errorf("could not connect to bigquery table %s.%s: %w", cfg.BigQueryDataset, cfg.BigQueryTable, err))
+		}
+	}
+
+	var webhookSink *webhookPublisher
+	if cfg.DestinationType == DestinationTypeHTTP {
+		webhookSink = newWebhookPublisher(cfg.DestinationURL, cfg.DestinationToken, cfg.DestinationTimeout)
+	}
+
+	var kafkaTransport *kafka.Transport
+	if cfg.DestinationType == DestinationTypeKafka {
+		var err error
+		if kafkaTransport, err = newKafkaTransport(cfg); err != nil {
+			return nil, withKind(KindConfig, fmt.Errorf("could not configure kafka connections: %w", err))
+		}
+	}
+
+	// fail releases the clients and destinations opened before err, by the
+	// created forwarders and by partial, the forwarder being created if any
+	fail := func(partial *forwarder, err error) (*Forwarder, error) {
+		created := fw.forwarders
+		if partial != nil {
+			created = append(created, partial)
+		}
+		for _, f := range created {
+			for _, t := range f.topics {
+				t.Stop()
+			}
+		}
+		// the sinks close once stopped by every forwarder and once more for
+		// the forwarders not created
+		if fileSink != nil {
+			fileSink.Stop()
+		}
+		if tableSink != nil {
+			tableSink.Stop()
+		}
+		if kafkaTransport != nil {
+			kafkaTransport.CloseIdleConnections()
+		}
+		fw.close()
+		return nil, err
+	}
+
+	for _, m := range cfg.Mappings {
+		fromClient, err := fromClients.Get(ctx, m.SourceProject())
+		if err != nil {
+			return fail(nil, withKind(KindConnection, fmt.Errorf("could not create pubsub client for source project %s: %w", m.SourceProject(), err)))
+		}
+		toClient, err := toClients.Get(ctx, m.DestinationProject())
+		if err != nil {
+			return fail(nil, withKind(KindConnection, fmt.Errorf("could not create pubsub client for destination project %s: %w", m.DestinationProject(), err)))
+		}
+
+		sub := SubscriptionIn(fromClient, m.PubSubSubscription)
+		if cfg.MirrorTopic {
+			if m.PubSubDestinationTopic, err = mirrorTopic(ctx, sub, cfg.MirrorTopicPrefix, cfg.MirrorTopicSuffix); err != nil {
+				return fail(nil, withKind(KindConnection, fmt.Errorf("could not resolve the topic of subscription %s: %w", m.PubSubSubscription, err)))
+			}
+			logrus.
+				WithField(logFieldSubscription, m.PubSubSubscription).
+				Infof("Mirroring to topic %s of project %s", m.PubSubDestinationTopic, m.DestinationProject())
+		}
+		receiveLimit := cfg.configureFlowControl(sub)
+		sub.ReceiveSettings.NumGoroutines = cfg.ReceiveGoroutines
+		sub.ReceiveSettings.Synchronous = cfg.SynchronousPull
+
+		f := &forwarder{
+			mapping:              m,
+			sub:                  sub,
+			receiveLimit:         receiveLimit,
+			attributes:           newAttributeFilter(cfg.AttributeAllowlist, cfg.AttributeBlocklist, steps.rename),
+			transform:            steps.transform,
+			filter:               steps.filter,
+			dataMatch:            steps.dataMatch,
+			requiredAttributes:   cfg.RequireAttributes,
+			orderingKeyAttribute: cfg.OrderingKeyAttribute,
+			ignoreOrdering:       cfg.IgnoreOrdering,
+			transcode:            steps.transcode,
+			envelope:             steps.envelope,
+			schema:               steps.schema,
+			dryRun:               cfg.DryRun,
+			dryRunAck:            cfg.DryRunAck,
+			asyncAck:             cfg.PublishAsyncAck,
+			fanOutMode:           cfg.FanOutMode,
+			ackMode:              cfg.AckMode,
+			tracing:              cfg.OtelEndpoint != "",
+			panicFatal:           cfg.PanicFatal,
+			decompressGzip:       cfg.DecompressGzip,
+			compressGzip:         cfg.CompressGzip,
+			maxMessageBytes:      cfg.MaxMessageBytes,
+			publishSlots:         publishSlots,
+			publishLimiter:       publishLimiter,
+			pause:                fw.pause,
+			activity:             fw.activity,
+			budget:               fw.budget,
+			inject:               steps.inject,
+			injectForwardedAt:    cfg.InjectForwardedTimestamp,
+			sequence:             sequence,
+			publishTimeout:       cfg.PublishTimeout,
+			nackDelay:            cfg.NackDelay,
+			maxMessageAgeWarn:    cfg.MaxMessageAgeWarn,
+			redeliveryWarn:       cfg.RedeliveryWarn,
+			authRetries:          cfg.ReceiveAuthRetries,
+			retry: retryPolicy{
+				maxAttempts: cfg.PublishMaxAttempts,
+				backoff:     backoff{initial: cfg.PublishInitialBackoff, max: cfg.PublishMaxBackoff},
+			},
+			receiveRetry: retryPolicy{
+				maxAttempts: cfg.ReceiveMaxRetries,
+				backoff:     backoff{initial: receiveBackoffInitial, max: cfg.ReceiveBackoffMax},
+			},
+		}
+		switch {
+		case fileSink != nil:
+			f.topics = []publisher{fileSink.acquire()}
+		case tableSink != nil:
+			f.topics = []publisher{tableSink.acquire()}
+		case webhookSink != nil:
+			f.topics = []publisher{webhookSink}
+		case kafkaTransport != nil:
+			names := m.DestinationTopics()
+			if cfg.KafkaTopic != "" {
+				names = []string{cfg.KafkaTopic}
+			}
+			for _, name := range names {
+				_, id, _ := parseResource(name, collectionTopics)
+				f.topics = append(f.topics, newKafkaPublisher(cfg, kafkaTransport, id))
+			}
+		case cfg.DestinationType == DestinationTypePubSubLite:
+			for _, name := range m.DestinationTopics() {
+				t, err := newLitePublisher(ctx, m.DestinationProject(), cfg.PubSubLiteLocation, name, toOpts...)
+				if err != nil {
+					return fail(f, withKind(KindConnection, fmt.Errorf("could not create pubsub lite publisher for topic %s: %w", name, err)))
+				}
+				f.topics = append(f.topics, t)
+			}
+		default:
+			for _, name := range m.DestinationTopics() {
+				t := TopicIn(toClient, name)
+				cfg.configureTopic(t, m.PublishProfile)
+				f.topics = append(f.topics, topicPublisher{t})
+			}
+		}
+		if cfg.DynamicTopicAttribute != "" {
+			profile := m.PublishProfile
+			f.router = newTopicRouter(toClient, cfg.DynamicTopicAttribute, cfg.TopicTemplate, func(t *pubsub.Topic) {
+				cfg.configureTopic(t, profile)
+			})
+		}
+		if cfg.ErrorLogSample != "" {
+			if f.errorLog, err = parseErrorLogSample(cfg.ErrorLogSample); err != nil {
+				return fail(f, withKind(KindConfig, fmt.Errorf("could not parse error log sample: %w", err)))
+			}
+		}
+		if cfg.CircuitFailureThreshold > 0 {
+			log := logrus.
+				WithField(logFieldSubscription, m.PubSubSubscription).
+				WithField(logFieldDestinationTopic, m.PubSubDestinationTopic)
+			f.breaker = newCircuitBreaker(cfg.CircuitFailureThreshold, cfg.CircuitResetTimeout, log, f.labels())
+		}
+		if cfg.SampleRate < 1 {
+			f.sampler = newSampler(cfg.SampleRate, cfg.SampleDeterministic, cfg.SampleAttribute)
+		}
+		if cfg.MinPublishTime != "" {
+			if f.minPublishTime, err = time.Parse(time.RFC3339, cfg.MinPublishTime); err != nil {
+				return fail(f, withKind(KindConfig, fmt.Errorf("could not parse min publish time: %w", err)))
+			}
+		}
+		if cfg.PreservePublishTime {
+			f.publishTimeAttribute = cfg.PublishTimeAttribute
+		}
+		if cfg.MaxInflightPerKey > 0 {
+			f.keySlots = newKeySlots(cfg.MaxInflightPerKey)
+		}
+		if cfg.RedeliveryTrackSize > 0 {
+			f.redeliveries = newRedeliveryTracker(cfg.RedeliveryTrackSize)
+		}
+		if cfg.DedupWindow > 0 {
+			f.dedup = newDedupCache(cfg.DedupAttribute, cfg.DedupSize, cfg.DedupWindow)
+		}
+		if cfg.DeadLetterTopic != "" {
+			f.deadLetter = newDeadLetter(TopicIn(toClient, cfg.DeadLetterTopic), cfg.MaxPublishRetries)
+		}
+		fw.forwarders = append(fw.forwarders, f)
+	}
+
+	// the endpoints are registered once, each run serving them again
+	if cfg.MetricsAddr != "" {
+		registerMetrics(fw.http.mux(cfg.MetricsAddr))
+	}
+	if cfg.HealthAddr != "" {
+		registerHealth(fw.http.mux(cfg.HealthAddr), fw.forwarders)
+	}
+	if cfg.AdminAddr != "" {
+		registerAdmin(fw.http.mux(cfg.AdminAddr), cfg.AdminToken, fw)
+	}
+	return fw, nil
+}
+
+// Run checks that the subscriptions and topics exist, then forwards messages
+// until ctx is done, the run duration elapsed or the subscriptions are
+// drained, and waits up to the shutdown timeout for in-flight messages. An
+// error is returned when a resource is missing or a mapping stopped with an
+// error.
+func (fw *Forwarder) Run(ctx context.Context) error {
+	defer fw.close()
+	cfg := fw.cfg
+
+	if err := fw.precheck(ctx); err != nil {
+		return err
+	}
+
+	if cfg.RunDuration > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, cfg.RunDuration)
+		defer cancel()
+	}
+	if cfg.DrainIdle > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithCancel(ctx)
+		defer cancel()
+		// the idle period starts with the run, not with the creation
+		fw.activity.touch()
+		go watchDrain(ctx, fw.activity, cfg.DrainIdle, cancel)
+	}
+	if fw.budget != nil {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithCancel(ctx)
+		defer cancel()
+		fw.budget.stop = cancel
+	}
+
+	var shutdownTracing func(context.Context) error
+	if cfg.OtelEndpoint != "" {
+		var err error
+		if shutdownTracing, err = setupTracing(ctx, cfg.OtelEndpoint, cfg.OtelInsecure, cfg.Version); err != nil {
+			return withKind(KindConnection, fmt.Errorf("could not set up tracing to %s: %w", cfg.OtelEndpoint, err))
+		}
+	}
+	if cfg.BacklogLogInterval > 0 {
+		if fw.monitoringOpts == nil {
+			logrus.Warn("Backlog logging disabled, the Monitoring API is not available with the emulator or injected clients")
+		} else {
+			monitor, err := newBacklogMonitor(ctx, fw.forwarders, fw.monitoringOpts...)
+			if err != nil {
+				return withKind(KindConnection, fmt.Errorf("could not create monitoring client: %w", err))
+			}
+			go monitor.run(ctx, cfg.BacklogLogInterval)
+		}
+	}
+	fw.http.start()
+	defer func() {
+		sctx, cancel := context.WithTimeout(context.Background(), cfg.ShutdownTimeout)
+		defer cancel()
+		fw.http.shutdown(sctx)
+	}()
+
+	// in-flight publishes use their own context so that a shutdown signal
+	// lets them complete instead of cancelling them right away
+	publishCtx, cancelPublish := context.WithCancel(context.Background())
+	defer cancelPublish()
+
+	done := make(chan []error, 1)
+	go func() {
+		done <- receiveAll(ctx, publishCtx, fw.forwarders)
+	}()
+
+	var failed []error
+	select {
+	case failed = <-done:
+	case <-ctx.Done():
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) && cfg.RunDuration > 0 {
+			logrus.Infof("Run duration of %s elapsed", cfg.RunDuration)
+		}
+		logrus.Infof("Shutdown requested, waiting up to %s for in-flight messages", cfg.ShutdownTimeout)
+		select {
+		case failed = <-done:
+		case <-time.After(cfg.ShutdownTimeout):
+			logrus.Warn("Shutdown timeout exceeded, nacking in-flight messages")
+			cancelPublish()
+			failed = <-done
+		}
+	}
+
+	if shutdownTracing != nil {
+		sctx, cancel := context.WithTimeout(context.Background(), cfg.ShutdownTimeout)
+		if err := shutdownTracing(sctx); err != nil {
+			logrus.Errorf("err when flushing traces: %v", err)
+		}
+		cancel()
+	}
+
+	if len(failed) == 0 {
+		return nil
+	}
+	// the first configuration or credentials error gives its kind to the
+	// failure, those need a fix before restarting
+	kind := KindRuntime
+	for _, err := range failed {
+		if k := receiveErrorKind(err); k != KindRuntime {
+			kind = k
+			break
+		}
+	}
+	return withKind(kind, fmt.Errorf("%d of %d mappings stopped with an error: %w", len(failed), len(fw.forwarders), failed[0]))
+}
+
+// close closes the pubsub clients of the forwarder
+func (fw *Forwarder) close() {
+	fw.fromClients.Close()
+	fw.toClients.Close()
+}
+
+// configureTopic applies the publish settings to a destination topic, then
+// the settings of the named publish profile when set
+func (cfg *Config) configureTopic(t *pubsub.Topic, profile string) {
+	// keeps the ordering key of messages received from an ordered
+	// subscription, messages without a key are published as before
+	t.EnableMessageOrdering = !cfg.IgnoreOrdering
+	t.PublishSettings.CountThreshold = cfg.PublishCountThreshold
+	t.PublishSettings.ByteThreshold = cfg.PublishByteThreshold
+	t.PublishSettings.DelayThreshold = cfg.PublishDelayThreshold
+	if profile != "" {
+		cfg.PublishProfiles[profile].apply(t)
+	}
+}
+
+// mirrorTopic returns the name of the destination topic mirroring the topic
+// of sub: its ID between prefix and suffix
+func mirrorTopic(ctx context.Context, sub *pubsub.Subscription, prefix, suffix string) (string, error) {
+	config, err := sub.Config(ctx)
+	if err != nil {
+		return "", err
+	}
+	if config.Topic == nil || config.Topic.ID() == deletedTopic {
+		return "", errors.New("the topic of the subscription was deleted")
+	}
+	return prefix + config.Topic.ID() + suffix, nil
+}
+
+// clientOptions returns the client options of the source and destination clients
+func (cfg *Config) clientOptions(ctx context.Context) (fromOpts, toOpts []option.ClientOption, err error) {
+	fromCreds, toCreds, err := cfg.clientCredentials(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+	return cfg.clientOptionsWith(fromCreds, toCreds)
+}
+
+// clientCredentials returns the credentials of the source and destination
+// clients, none being used with the emulator
+func (cfg *Config) clientCredentials(ctx context.Context) (fromCreds, toCreds *reloadableCredentials, err error) {
+	if cfg.EmulatorHost != "" {
+		logrus.Infof("Using pubsub emulator on %s, credentials are ignored", cfg.EmulatorHost)
+		return nil, nil, nil
+	}
+
+	fromCreds, err = credentials(ctx, cfg.FromGoogleApplicationCredentials, cfg.FromGoogleApplicationCredentialsFile, cfg.FromCredentialsSecret, cfg.FromCredentialsKMSKey, cfg.scopes())
+	if err != nil {
+		return nil, nil, withKind(KindCredentials, fmt.Errorf("could not find source credentials: %w", err))
+	}
+
+	toCreds = fromCreds
+	if !cfg.sameCredentials() {
+		toCreds, err = credentials(ctx, cfg.ToGoogleApplicationCredentials, cfg.ToGoogleApplicationCredentialsFile, cfg.ToCredentialsSecret, cfg.ToCredentialsKMSKey, cfg.scopes())
+		if err != nil {
+			return nil, nil, withKind(KindCredentials, fmt.Errorf("could not find destination credentials: %w", err))
+		}
+	}
+	return fromCreds, toCreds, nil
+}
+
+// clientOptionsWith returns the client options of the source and
+// destination clients authenticating with the given credentials
+func (cfg *Config) clientOptionsWith(fromCreds, toCreds *reloadableCredentials) (fromOpts, toOpts []option.ClientOption, err error) {
+	grpcOpts := cfg.keepaliveOptions()
+	if cfg.GRPCConnectionPool > 0 {
+		grpcOpts = append(grpcOpts, option.WithGRPCConnectionPool(cfg.GRPCConnectionPool))
+	}
+	if cfg.EmulatorHost != "" {
+		return append(emulatorOptions(cfg.EmulatorHost), grpcOpts...), append(emulatorOptions(cfg.EmulatorHost), grpcOpts...), nil
+	}
+
+	endpointOpts, err := endpointOptions(cfg.Endpoint, cfg.CACertFile, cfg.ClientCertFile, cfg.ClientKeyFile)
+	if err != nil {
+		return nil, nil, withKind(KindConfig, fmt.Errorf("could not configure pubsub endpoint: %w", err))
+	}
+
+	fromOpts = append(append([]option.ClientOption{fromCreds.option()}, endpointOpts...), grpcOpts...)
+	toOpts = append(append([]option.ClientOption{toCreds.option()}, endpointOpts...), grpcOpts...)
+	return fromOpts, toOpts, nil
+}
+
+// keepaliveOptions returns the client options overriding the grpc keepalive
+// parameters of the client libraries when they are set
+func (cfg *Config) keepaliveOptions() []option.ClientOption {
+	if cfg.GRPCKeepaliveTime == 0 && cfg.GRPCKeepaliveTimeout == 0 {
+		return nil
+	}
+	params := keepalive.ClientParameters{
+		Time:    cfg.GRPCKeepaliveTime,
+		Timeout: cfg.GRPCKeepaliveTimeout,
+	}
+	if params.Time == 0 {
+		params.Time = defaultGRPCKeepaliveTime
+	}
+	return []option.ClientOption{option.WithGRPCDialOption(grpc.WithKeepaliveParams(params))}
+}
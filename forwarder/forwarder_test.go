@@ -0,0 +1,254 @@
+package forwarder
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+
+	"cloud.google.com/go/pubsub"
+	"cloud.google.com/go/pubsub/pstest"
+)
+
+// testConfig returns a valid configuration forwarding src-sub to dst in
+// project p
+func testConfig() Config {
+	return Config{
+		Mappings: []Mapping{{
+			PubSubSubscription:     "src-sub",
+			PubSubDestinationTopic: "dst",
+			FromGoogleCloudProject: "p",
+			ToGoogleCloudProject:   "p",
+		}},
+		ShutdownTimeout:        time.Second,
+		PublishCountThreshold:  1,
+		PublishByteThreshold:   pubsub.DefaultPublishSettings.ByteThreshold,
+		MaxOutstandingMessages: 10,
+		MaxOutstandingBytes:    pubsub.DefaultReceiveSettings.MaxOutstandingBytes,
+		ReceiveGoroutines:      1,
+		DestinationType:        DestinationTypePubSub,
+		FanOutMode:             FanOutModeAll,
+		AckMode:                AckModeOnSuccess,
+		FlowControlBehavior:    FlowControlBlock,
+		PublishMaxAttempts:     1,
+		SampleRate:             1,
+	}
+}
+
+func TestNewWithClients(t *testing.T) {
+	ctx := context.Background()
+	srv := pstest.NewServer()
+	defer srv.Close()
+	client, err := pubsub.NewClient(ctx, "p", emulatorOptions(srv.Addr)...)
+	if err != nil {
+		t.Fatalf("pubsub.NewClient() error = %v", err)
+	}
+	defer client.Close()
+
+	src, err := client.CreateTopic(ctx, "src")
+	if err != nil {
+		t.Fatalf("CreateTopic() error = %v", err)
+	}
+	if _, err := client.CreateSubscription(ctx, "src-sub", pubsub.SubscriptionConfig{Topic: src}); err != nil {
+		t.Fatalf("CreateSubscription() error = %v", err)
+	}
+	dst, err := client.CreateTopic(ctx, "dst")
+	if err != nil {
+		t.Fatalf("CreateTopic() error = %v", err)
+	}
+	dstSub, err := client.CreateSubscription(ctx, "dst-sub", pubsub.SubscriptionConfig{Topic: dst})
+	if err != nil {
+		t.Fatalf("CreateSubscription() error = %v", err)
+	}
+
+	fw, err := NewWithClients(client, client, testConfig())
+	if err != nil {
+		t.Fatalf("NewWithClients() error = %v", err)
+	}
+
+	runCtx, stop := context.WithTimeout(ctx, 5*time.Second)
+	defer stop()
+	done := make(chan error, 1)
+	go func() { done <- fw.Run(runCtx) }()
+
+	if _, err := src.Publish(ctx, &pubsub.Message{Data: []byte("hello"), Attributes: map[string]string{"k": "v"}}).Get(ctx); err != nil {
+		t.Fatalf("Publish() error = %v", err)
+	}
+
+	received := make(chan *pubsub.Message, 1)
+	recvCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	err = dstSub.Receive(recvCtx, func(_ context.Context, msg *pubsub.Message) {
+		msg.Ack()
+		select {
+		case received <- msg:
+		default:
+		}
+		cancel()
+	})
+	if err != nil {
+		t.Fatalf("Receive() error = %v", err)
+	}
+	select {
+	case msg := <-received:
+		if string(msg.Data) != "hello" || msg.Attributes["k"] != "v" {
+			t.Errorf("forwarded message = %q %v, want %q with k=v", msg.Data, msg.Attributes, "hello")
+		}
+	default:
+		t.Fatal("message not forwarded to the destination topic")
+	}
+
+	stop()
+	if err := <-done; err != nil {
+		t.Errorf("Run() error = %v", err)
+	}
+}
+
+func TestRunTwiceWithHealth(t *testing.T) {
+	ctx := context.Background()
+	srv := pstest.NewServer()
+	defer srv.Close()
+	client, err := pubsub.NewClient(ctx, "p", emulatorOptions(srv.Addr)...)
+	if err != nil {
+		t.Fatalf("pubsub.NewClient() error = %v", err)
+	}
+	defer client.Close()
+
+	src, err := client.CreateTopic(ctx, "src")
+	if err != nil {
+		t.Fatalf("CreateTopic() error = %v", err)
+	}
+	if _, err := client.CreateSubscription(ctx, "src-sub", pubsub.SubscriptionConfig{Topic: src}); err != nil {
+		t.Fatalf("CreateSubscription() error = %v", err)
+	}
+	if _, err := client.CreateTopic(ctx, "dst"); err != nil {
+		t.Fatalf("CreateTopic() error = %v", err)
+	}
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("net.Listen() error = %v", err)
+	}
+	addr := listener.Addr().String()
+	listener.Close()
+
+	cfg := testConfig()
+	cfg.HealthAddr = addr
+	cfg.MetricsAddr = addr
+	first, err := NewWithClients(client, client, cfg)
+	if err != nil {
+		t.Fatalf("NewWithClients() error = %v", err)
+	}
+	// a second forwarder registers its endpoints on its own muxes
+	second, err := NewWithClients(client, client, cfg)
+	if err != nil {
+		t.Fatalf("NewWithClients() error = %v", err)
+	}
+
+	for i, fw := range []*Forwarder{first, first, second} {
+		runCtx, stop := context.WithCancel(ctx)
+		done := make(chan error, 1)
+		go func() { done <- fw.Run(runCtx) }()
+
+		var status int
+		for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+			resp, err := http.Get("http://" + addr + livenessPath)
+			if err != nil {
+				continue
+			}
+			resp.Body.Close()
+			if status = resp.StatusCode; status == http.StatusOK {
+				break
+			}
+		}
+		stop()
+		if err := <-done; err != nil {
+			t.Fatalf("run %d: Run() error = %v", i, err)
+		}
+		if status != http.StatusOK {
+			t.Fatalf("run %d: %s status = %d, want %d", i, livenessPath, status, http.StatusOK)
+		}
+		// the server is shut down with the run, freeing the address
+		if resp, err := http.Get("http://" + addr + livenessPath); err == nil {
+			resp.Body.Close()
+			t.Fatalf("run %d: %s still served after Run returned", i, livenessPath)
+		}
+	}
+}
+
+func TestRouteOnReceivedAttributes(t *testing.T) {
+	ctx := context.Background()
+	srv := pstest.NewServer()
+	defer srv.Close()
+	client, err := pubsub.NewClient(ctx, "p", emulatorOptions(srv.Addr)...)
+	if err != nil {
+		t.Fatalf("pubsub.NewClient() error = %v", err)
+	}
+	defer client.Close()
+
+	src, err := client.CreateTopic(ctx, "src")
+	if err != nil {
+		t.Fatalf("CreateTopic() error = %v", err)
+	}
+	if _, err := client.CreateSubscription(ctx, "src-sub", pubsub.SubscriptionConfig{Topic: src}); err != nil {
+		t.Fatalf("CreateSubscription() error = %v", err)
+	}
+	if _, err := client.CreateTopic(ctx, "dst"); err != nil {
+		t.Fatalf("CreateTopic() error = %v", err)
+	}
+	routed, err := client.CreateTopic(ctx, "routed")
+	if err != nil {
+		t.Fatalf("CreateTopic() error = %v", err)
+	}
+	routedSub, err := client.CreateSubscription(ctx, "routed-sub", pubsub.SubscriptionConfig{Topic: routed})
+	if err != nil {
+		t.Fatalf("CreateSubscription() error = %v", err)
+	}
+
+	cfg := testConfig()
+	cfg.DynamicTopicAttribute = "route"
+	// the routing attribute is dropped from the forwarded message
+	cfg.AttributeMapping = []string{"route="}
+	fw, err := NewWithClients(client, client, cfg)
+	if err != nil {
+		t.Fatalf("NewWithClients() error = %v", err)
+	}
+
+	runCtx, stop := context.WithTimeout(ctx, 5*time.Second)
+	defer stop()
+	done := make(chan error, 1)
+	go func() { done <- fw.Run(runCtx) }()
+
+	if _, err := src.Publish(ctx, &pubsub.Message{Data: []byte("hello"), Attributes: map[string]string{"route": "routed"}}).Get(ctx); err != nil {
+		t.Fatalf("Publish() error = %v", err)
+	}
+
+	received := make(chan *pubsub.Message, 1)
+	recvCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	err = routedSub.Receive(recvCtx, func(_ context.Context, msg *pubsub.Message) {
+		msg.Ack()
+		select {
+		case received <- msg:
+		default:
+		}
+		cancel()
+	})
+	if err != nil {
+		t.Fatalf("Receive() error = %v", err)
+	}
+	select {
+	case msg := <-received:
+		if _, ok := msg.Attributes["route"]; ok {
+			t.Errorf("routed message attributes = %v, want route dropped", msg.Attributes)
+		}
+	default:
+		t.Fatal("message not routed to the topic of its route attribute")
+	}
+
+	stop()
+	if err := <-done; err != nil {
+		t.Errorf("Run() error = %v", err)
+	}
+}
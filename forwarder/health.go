@@ -0,0 +1,37 @@
+package forwarder
+
+import (
+	"net/http"
+	"sync/atomic"
+)
+
+const (
+	livenessPath  = "/healthz"
+	readinessPath = "/readyz"
+)
+
+// forwarder states reported by the readiness probe
+const (
+	stateStarting int32 = iota
+	stateReady
+	stateFailed
+)
+
+// registerHealth exposes the liveness and readiness probes of forwarders on mux
+func registerHealth(mux *http.ServeMux, forwarders []*forwarder) {
+	mux.HandleFunc(livenessPath, func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+		_, _ = w.Write([]byte("ok"))
+	})
+	mux.HandleFunc(readinessPath, func(w http.ResponseWriter, r *http.Request) {
+		for _, f := range forwarders {
+			if atomic.LoadInt32(&f.state) != stateReady {
+				w.WriteHeader(http.StatusServiceUnavailable)
+				_, _ = w.Write([]byte(f.mapping.PubSubSubscription + " is not ready"))
+				return
+			}
+		}
+		w.WriteHeader(http.StatusOK)
+		_, _ = w.Write([]byte("ok"))
+	})
+}
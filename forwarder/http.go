@@ -0,0 +1,78 @@
+package forwarder
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"net/http"
+	"sync"
+
+	"github.com/sirupsen/logrus"
+)
+
+// httpServers holds the metrics, health and admin endpoints of a forwarder,
+// one mux per listen address so that they can share a port when configured
+// with the same address
+type httpServers struct {
+	// tlsConfig is the TLS configuration of the servers, nil to serve plain
+	// http
+	tlsConfig *tls.Config
+	muxes     map[string]*http.ServeMux
+
+	mu      sync.Mutex
+	servers []*http.Server
+}
+
+// newHTTPServers returns the servers of the endpoints, served over TLS when
+// tlsConfig is set
+func newHTTPServers(tlsConfig *tls.Config) *httpServers {
+	return &httpServers{tlsConfig: tlsConfig, muxes: map[string]*http.ServeMux{}}
+}
+
+// mux returns the mux serving addr
+func (s *httpServers) mux(addr string) *http.ServeMux {
+	mux, ok := s.muxes[addr]
+	if !ok {
+		mux = http.NewServeMux()
+		s.muxes[addr] = mux
+	}
+	return mux
+}
+
+// start serves every registered mux in the background until shutdown
+func (s *httpServers) start() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for addr, mux := range s.muxes {
+		// a server can not be started again once shut down, each run has its own
+		server := &http.Server{Addr: addr, Handler: mux, TLSConfig: s.tlsConfig}
+		s.servers = append(s.servers, server)
+		go func(addr string, server *http.Server) {
+			var err error
+			if server.TLSConfig != nil {
+				logrus.Infof("Serving https on %s", addr)
+				// the certificate is loaded in the TLS configuration
+				err = server.ListenAndServeTLS("", "")
+			} else {
+				logrus.Infof("Serving http on %s", addr)
+				err = server.ListenAndServe()
+			}
+			if err != nil && !errors.Is(err, http.ErrServerClosed) {
+				logrus.Errorf("err when serving http on %s: %v", addr, err)
+			}
+		}(addr, server)
+	}
+}
+
+// shutdown stops the started servers, waiting for their active requests
+// until ctx is done
+func (s *httpServers) shutdown(ctx context.Context) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, server := range s.servers {
+		if err := server.Shutdown(ctx); err != nil {
+			logrus.Errorf("err when shutting down http server on %s: %v", server.Addr, err)
+		}
+	}
+	s.servers = nil
+}
@@ -0,0 +1,129 @@
+package forwarder
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"time"
+
+	"cloud.google.com/go/pubsub"
+	"github.com/segmentio/kafka-go"
+	"github.com/segmentio/kafka-go/sasl"
+	"github.com/segmentio/kafka-go/sasl/plain"
+	"github.com/segmentio/kafka-go/sasl/scram"
+)
+
+// supported SASL mechanisms of kafka destinations
+const (
+	KafkaSASLPlain       = "plain"
+	KafkaSASLSCRAMSHA256 = "scram-sha-256"
+	KafkaSASLSCRAMSHA512 = "scram-sha-512"
+)
+
+// kafkaPublisher produces messages to a kafka topic, the data as value and
+// the attributes as headers. A publish succeeds once acknowledged by all the
+// in-sync replicas.
+type kafkaPublisher struct {
+	writer *kafka.Writer
+	// keyAttribute is the attribute giving the key of produced records, the
+	// ordering key being used when empty
+	keyAttribute string
+}
+
+// newKafkaTransport returns the connections to the brokers shared by the
+// kafka publishers of cfg
+func newKafkaTransport(cfg Config) (*kafka.Transport, error) {
+	transport := &kafka.Transport{}
+	if cfg.KafkaTLS {
+		transport.TLS = &tls.Config{MinVersion: tls.VersionTLS12}
+		if cfg.KafkaCACertFile != "" {
+			pool, err := caCertPool(cfg.KafkaCACertFile)
+			if err != nil {
+				return nil, err
+			}
+			transport.TLS.RootCAs = pool
+		}
+	}
+
+	var mechanism sasl.Mechanism
+	switch cfg.KafkaSASLMechanism {
+	case "":
+	case KafkaSASLPlain:
+		mechanism = plain.Mechanism{Username: cfg.KafkaSASLUsername, Password: cfg.KafkaSASLPassword}
+	case KafkaSASLSCRAMSHA256, KafkaSASLSCRAMSHA512:
+		algo := scram.SHA256
+		if cfg.KafkaSASLMechanism == KafkaSASLSCRAMSHA512 {
+			algo = scram.SHA512
+		}
+		var err error
+		if mechanism, err = scram.Mechanism(algo, cfg.KafkaSASLUsername, cfg.KafkaSASLPassword); err != nil {
+			return nil, err
+		}
+	}
+	transport.SASL = mechanism
+	return transport, nil
+}
+
+func newKafkaPublisher(cfg Config, transport *kafka.Transport, topic string) *kafkaPublisher {
+	w := &kafka.Writer{
+		Addr:      kafka.TCP(cfg.KafkaBrokers...),
+		Topic:     topic,
+		Transport: transport,
+		// records with the same key go to the same partition, the others
+		// being spread over the partitions
+		Balancer:     &kafka.Hash{},
+		RequiredAcks: kafka.RequireAll,
+		BatchSize:    cfg.PublishCountThreshold,
+	}
+	if cfg.PublishDelayThreshold > 0 {
+		w.BatchTimeout = cfg.PublishDelayThreshold
+	} else {
+		w.BatchTimeout = time.Millisecond
+	}
+	return &kafkaPublisher{writer: w, keyAttribute: cfg.KafkaKeyAttribute}
+}
+
+func (p *kafkaPublisher) Publish(ctx context.Context, msg *pubsub.Message) publishResult {
+	record := kafka.Message{Value: msg.Data}
+	key := msg.OrderingKey
+	if p.keyAttribute != "" {
+		key = msg.Attributes[p.keyAttribute]
+	}
+	if key != "" {
+		record.Key = []byte(key)
+	}
+	for k, v := range msg.Attributes {
+		record.Headers = append(record.Headers, kafka.Header{Key: k, Value: []byte(v)})
+	}
+
+	// the writer batches the records written concurrently
+	res := &asyncResult{done: make(chan struct{})}
+	go func() {
+		defer close(res.done)
+		res.err = kafkaError(p.writer.WriteMessages(ctx, record))
+	}()
+	return res
+}
+
+// kafkaError returns the error of a single record write, records that are
+// too large being rejected
+func kafkaError(err error) error {
+	var errs kafka.WriteErrors
+	if errors.As(err, &errs) && len(errs) == 1 {
+		err = errs[0]
+	}
+	if errors.Is(err, kafka.MessageSizeTooLarge) {
+		return &rejectedError{err}
+	}
+	return err
+}
+
+// Stop flushes the pending records
+func (p *kafkaPublisher) Stop() {
+	_ = p.writer.Close()
+}
+
+func (p *kafkaPublisher) String() string {
+	return fmt.Sprintf("kafka:%s", p.writer.Topic)
+}
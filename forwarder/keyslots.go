@@ -0,0 +1,71 @@
+package forwarder
+
+import (
+	"context"
+	"sync"
+)
+
+// keySlots bounds the publishes awaited at once for each ordering key, the
+// slots of a key being dropped once none is taken so that memory does not
+// grow with the number of keys seen
+type keySlots struct {
+	max int
+
+	mu   sync.Mutex
+	keys map[string]*keySlot
+}
+
+type keySlot struct {
+	slots chan struct{}
+	// users counts the holders and waiters of the slots
+	users int
+}
+
+func newKeySlots(max int) *keySlots {
+	return &keySlots{max: max, keys: map[string]*keySlot{}}
+}
+
+// acquire takes a slot of key, waiting for one to be released until ctx is
+// done. Messages without ordering key are not limited.
+func (k *keySlots) acquire(ctx context.Context, key string) error {
+	if k == nil || key == "" {
+		return nil
+	}
+	k.mu.Lock()
+	s, ok := k.keys[key]
+	if !ok {
+		s = &keySlot{slots: make(chan struct{}, k.max)}
+		k.keys[key] = s
+	}
+	s.users++
+	k.mu.Unlock()
+
+	select {
+	case s.slots <- struct{}{}:
+		return nil
+	case <-ctx.Done():
+		k.mu.Lock()
+		k.leave(key, s)
+		k.mu.Unlock()
+		return ctx.Err()
+	}
+}
+
+// release frees the slot of key taken by acquire
+func (k *keySlots) release(key string) {
+	if k == nil || key == "" {
+		return
+	}
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	s := k.keys[key]
+	<-s.slots
+	k.leave(key, s)
+}
+
+// leave drops the slots of key once nobody uses them, k.mu being held
+func (k *keySlots) leave(key string, s *keySlot) {
+	if s.users--; s.users == 0 {
+		delete(k.keys, key)
+	}
+}
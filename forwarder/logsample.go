@@ -0,0 +1,74 @@
+package forwarder
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// errorLogInterval is the period of the aggregate line of sampled errors
+const errorLogInterval = time.Minute
+
+// errorSampler limits the per-message error logs: the first errors of each
+// interval are logged, then one in every. The number of errors of the
+// interval is logged at its end.
+type errorSampler struct {
+	first int64
+	every int64
+
+	// count and logged are the errors of the current interval, accessed
+	// atomically
+	count  int64
+	logged int64
+}
+
+// parseErrorLogSample parses a first:every sample, e.g. 10:100 to log the
+// first 10 errors then 1 in 100
+func parseErrorLogSample(sample string) (*errorSampler, error) {
+	parts := strings.SplitN(sample, ":", 2)
+	if len(parts) != 2 {
+		return nil, fmt.Errorf("%q is not a first:every sample", sample)
+	}
+	first, err := strconv.ParseInt(parts[0], 10, 64)
+	if err != nil || first < 0 {
+		return nil, fmt.Errorf("%q is not a positive number of errors", parts[0])
+	}
+	every, err := strconv.ParseInt(parts[1], 10, 64)
+	if err != nil || every < 1 {
+		return nil, fmt.Errorf("%q is not a number of errors of at least 1", parts[1])
+	}
+	return &errorSampler{first: first, every: every}, nil
+}
+
+// allow records an error and reports whether it is logged
+func (s *errorSampler) allow() bool {
+	n := atomic.AddInt64(&s.count, 1)
+	if n <= s.first || (n-s.first)%s.every == 0 {
+		atomic.AddInt64(&s.logged, 1)
+		return true
+	}
+	return false
+}
+
+// run logs the number of errors of each interval until ctx is done
+func (s *errorSampler) run(ctx context.Context, log *logrus.Entry) {
+	ticker := time.NewTicker(errorLogInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			count := atomic.SwapInt64(&s.count, 0)
+			logged := atomic.SwapInt64(&s.logged, 0)
+			if count > logged {
+				log.Warnf("%d message errors in the last %s, %d of them logged", count, errorLogInterval, logged)
+			}
+		}
+	}
+}
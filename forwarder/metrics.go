@@ -0,0 +1,157 @@
+package forwarder
+
+import (
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const (
+	metricsNamespace = "pubsub_to_pubsub"
+	metricsPath      = "/metrics"
+)
+
+var metricsLabels = []string{"subscription", "topic"}
+
+var (
+	messagesReceived = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "messages_received_total",
+		Help:      "Number of messages received from the subscription.",
+	}, metricsLabels)
+	messagesPublished = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "messages_published_total",
+		Help:      "Number of messages successfully published to the destination topic.",
+	}, metricsLabels)
+	publishFailures = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "publish_failures_total",
+		Help:      "Number of failed publishes to the destination topic.",
+	}, metricsLabels)
+	messagesNacked = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "messages_nacked_total",
+		Help:      "Number of messages nacked back to the subscription.",
+	}, metricsLabels)
+	messagesDeadLettered = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "messages_dead_lettered_total",
+		Help:      "Number of messages published to the dead-letter topic.",
+	}, metricsLabels)
+	transformFailures = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "transform_failures_total",
+		Help:      "Number of messages nacked because their transform failed.",
+	}, metricsLabels)
+	decompressFailures = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "decompress_failures_total",
+		Help:      "Number of messages nacked because their data could not be decompressed.",
+	}, metricsLabels)
+	transcodeFailures = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "transcode_failures_total",
+		Help:      "Number of messages dead-lettered or nacked because their data could not be transcoded.",
+	}, metricsLabels)
+	envelopeFailures = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "envelope_failures_total",
+		Help:      "Number of messages dead-lettered or nacked because the envelope template failed on them.",
+	}, metricsLabels)
+	messagesFlowControlled = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "messages_flow_controlled_total",
+		Help:      "Number of messages nacked because they were received beyond the flow control limits with the signal-error behavior.",
+	}, metricsLabels)
+	messagesOversized = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "messages_oversized_total",
+		Help:      "Number of messages dead-lettered or dropped because they exceed the maximum message size.",
+	}, metricsLabels)
+	messagesInvalid = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "messages_invalid_total",
+		Help:      "Number of messages dead-lettered or dropped because their data does not match the schema.",
+	}, metricsLabels)
+	duplicatesDropped = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "duplicates_dropped_total",
+		Help:      "Number of messages acked without being published because they were already forwarded within the dedup window.",
+	}, metricsLabels)
+	messagesRedelivered = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "redelivered_messages_total",
+		Help:      "Number of messages received again with an ID already seen by the process.",
+	}, metricsLabels)
+	messagesMissingAttributes = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "messages_missing_attributes_total",
+		Help:      "Number of messages dead-lettered or dropped because a required attribute is missing.",
+	}, metricsLabels)
+	messagesFiltered = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "messages_filtered_total",
+		Help:      "Number of messages acked without being published because they did not match the filter.",
+	}, metricsLabels)
+	messagesDataUnmatched = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "messages_data_unmatched_total",
+		Help:      "Number of messages acked without being published because their data did not match the data regex.",
+	}, metricsLabels)
+	messagesBeforeMinPublishTime = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "messages_before_min_publish_time_total",
+		Help:      "Number of messages acked without being published because they were published before the min publish time.",
+	}, metricsLabels)
+	callbackPanics = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "callback_panics_total",
+		Help:      "Number of messages nacked because handling them panicked.",
+	}, metricsLabels)
+	messagesSampledOut = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "messages_sampled_out_total",
+		Help:      "Number of messages acked without being published because they were not part of the sample.",
+	}, metricsLabels)
+	messagesDropped = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "messages_dropped_total",
+		Help:      "Number of messages acked without being forwarded or dead-lettered, by drop reason.",
+	}, append(metricsLabels, "reason"))
+	publishLatency = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: metricsNamespace,
+		Name:      "publish_latency_seconds",
+		Help:      "Time taken to publish a message and get the server acknowledgement.",
+		Buckets:   prometheus.DefBuckets,
+	}, metricsLabels)
+	messageAge = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: metricsNamespace,
+		Name:      "message_age_seconds",
+		Help:      "Time between the publish of a message to the source topic and its reception by the forwarder.",
+		Buckets:   []float64{0.1, 0.5, 1, 5, 10, 30, 60, 300, 900, 3600, 21600, 86400},
+	}, metricsLabels)
+	redeliveryInterval = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: metricsNamespace,
+		Name:      "redelivery_interval_seconds",
+		Help:      "Time between the first reception of a message and its redelivery.",
+		Buckets:   []float64{1, 5, 10, 30, 60, 120, 300, 600, 1800, 3600},
+	}, metricsLabels)
+	subscriptionBacklog = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: metricsNamespace,
+		Name:      "subscription_backlog_messages",
+		Help:      "Latest number of undelivered messages of the subscription reported by Cloud Monitoring.",
+	}, metricsLabels)
+	circuitBreakerOpen = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: metricsNamespace,
+		Name:      "circuit_breaker_open",
+		Help:      "1 while the circuit breaker of the mapping is open or half-open, messages being nacked, 0 otherwise.",
+	}, metricsLabels)
+)
+
+// registerMetrics exposes the prometheus metrics on mux
+func registerMetrics(mux *http.ServeMux) {
+	mux.Handle(metricsPath, promhttp.Handler())
+}
@@ -0,0 +1,179 @@
+package forwarder
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"cloud.google.com/go/iam"
+	"cloud.google.com/go/pubsub"
+	"github.com/sirupsen/logrus"
+	"google.golang.org/api/iterator"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// maxListedResources bounds the names listed after a missing resource
+const maxListedResources = 20
+
+// permissions needed by the forwarder, with the roles granting them
+const (
+	permissionConsume = "pubsub.subscriptions.consume"
+	permissionPublish = "pubsub.topics.publish"
+	roleSubscriber    = "roles/pubsub.subscriber"
+	rolePublisher     = "roles/pubsub.publisher"
+)
+
+// precheck checks that the subscriptions and destination topics of the
+// mappings exist, so that a wrong name fails with a clear message instead
+// of a receive or publish error, then that the credentials are granted the
+// permissions to consume the subscriptions and publish to the topics, so that
+// a missing grant does not nack every message. Resources that can not be
+// checked, e.g. for lack of the get permission, are skipped.
+func (fw *Forwarder) precheck(ctx context.Context) error {
+	var problems []string
+	for _, f := range fw.forwarders {
+		if problem := fw.checkSubscription(ctx, f.sub); problem != "" {
+			problems = append(problems, problem)
+		}
+		for _, p := range f.topics {
+			if t, ok := p.(topicPublisher); ok {
+				if problem := fw.checkTopic(ctx, t.Topic); problem != "" {
+					problems = append(problems, problem)
+				}
+			}
+		}
+	}
+	if len(problems) > 0 {
+		return withKind(KindConfig, fmt.Errorf("%s", strings.Join(problems, " ")))
+	}
+
+	for _, f := range fw.forwarders {
+		if problem := checkPermission(ctx, f.sub.IAM(), f.sub.String(), permissionConsume, roleSubscriber); problem != "" {
+			problems = append(problems, problem)
+		}
+		// dry runs do not publish, e.g. with read-only credentials
+		if f.dryRun {
+			continue
+		}
+		for _, p := range f.topics {
+			if t, ok := p.(topicPublisher); ok {
+				if problem := checkPermission(ctx, t.IAM(), t.String(), permissionPublish, rolePublisher); problem != "" {
+					problems = append(problems, problem)
+				}
+			}
+		}
+		if f.deadLetter != nil {
+			t := f.deadLetter.topic
+			if problem := checkPermission(ctx, t.IAM(), t.String(), permissionPublish, rolePublisher); problem != "" {
+				problems = append(problems, problem)
+			}
+		}
+	}
+	if len(problems) > 0 {
+		return withKind(KindCredentials, fmt.Errorf("%s", strings.Join(problems, " ")))
+	}
+	return nil
+}
+
+// checkPermission returns the problem of the resource of handle when the
+// credentials are not granted permission on it
+func checkPermission(ctx context.Context, handle *iam.Handle, resource, permission, role string) string {
+	granted, err := handle.TestPermissions(ctx, []string{permission})
+	if status.Code(err) == codes.Unimplemented {
+		// the emulator has no IAM
+		return ""
+	}
+	if err != nil {
+		logrus.Warnf("Could not check the %s permission on %s: %v", permission, resource, err)
+		return ""
+	}
+	for _, p := range granted {
+		if p == permission {
+			return ""
+		}
+	}
+	return fmt.Sprintf("Credentials are not granted %s on %s, e.g. with the %s role.", permission, resource, role)
+}
+
+// checkSubscription returns the problem of sub when it does not exist
+func (fw *Forwarder) checkSubscription(ctx context.Context, sub *pubsub.Subscription) string {
+	exists, err := sub.Exists(ctx)
+	if err != nil {
+		logrus.Warnf("Could not check that subscription %s exists: %v", sub, err)
+		return ""
+	}
+	if exists {
+		return ""
+	}
+	project, _, _ := parseResource(sub.String(), collectionSubscriptions)
+	problem := fmt.Sprintf("Subscription %s does not exist in project %s.", sub.ID(), project)
+	if !fw.cfg.ListAvailable {
+		return problem
+	}
+	client, err := fw.fromClients.Get(ctx, project)
+	if err != nil {
+		return problem
+	}
+	subs := client.Subscriptions(ctx)
+	return problem + available("subscriptions", project, func() (string, error) {
+		s, err := subs.Next()
+		if err != nil {
+			return "", err
+		}
+		return s.ID(), nil
+	})
+}
+
+// checkTopic returns the problem of t when it does not exist
+func (fw *Forwarder) checkTopic(ctx context.Context, t *pubsub.Topic) string {
+	exists, err := t.Exists(ctx)
+	if err != nil {
+		logrus.Warnf("Could not check that topic %s exists: %v", t, err)
+		return ""
+	}
+	if exists {
+		return ""
+	}
+	project, _, _ := parseResource(t.String(), collectionTopics)
+	problem := fmt.Sprintf("Topic %s does not exist in project %s.", t.ID(), project)
+	if !fw.cfg.ListAvailable {
+		return problem
+	}
+	client, err := fw.toClients.Get(ctx, project)
+	if err != nil {
+		return problem
+	}
+	topics := client.Topics(ctx)
+	return problem + available("topics", project, func() (string, error) {
+		t, err := topics.Next()
+		if err != nil {
+			return "", err
+		}
+		return t.ID(), nil
+	})
+}
+
+// available returns the sentence listing the names returned by next, up to
+// maxListedResources of them
+func available(collection, project string, next func() (string, error)) string {
+	var names []string
+	for len(names) <= maxListedResources {
+		name, err := next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			logrus.Warnf("Could not list the %s of project %s: %v", collection, project, err)
+			return ""
+		}
+		names = append(names, name)
+	}
+	switch {
+	case len(names) == 0:
+		return fmt.Sprintf(" Project %s has no %s.", project, collection)
+	case len(names) > maxListedResources:
+		return fmt.Sprintf(" Available %s: %s, ...", collection, strings.Join(names[:maxListedResources], ", "))
+	}
+	return fmt.Sprintf(" Available %s: %s.", collection, strings.Join(names, ", "))
+}
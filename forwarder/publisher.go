@@ -0,0 +1,161 @@
+package forwarder
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"cloud.google.com/go/pubsub"
+	"cloud.google.com/go/pubsublite/pscompat"
+	"google.golang.org/api/option"
+)
+
+// supported destination types
+const (
+	DestinationTypePubSub     = "pubsub"
+	DestinationTypePubSubLite = "pubsublite"
+	DestinationTypeFile       = "file"
+	DestinationTypeBigQuery   = "bigquery"
+	DestinationTypeHTTP       = "http"
+	DestinationTypeKafka      = "kafka"
+)
+
+// publisher publishes messages to a destination. It is implemented by pubsub
+// topics, pubsub lite publisher clients, files, bigquery tables, HTTP
+// endpoints and kafka topics.
+type publisher interface {
+	Publish(ctx context.Context, msg *pubsub.Message) publishResult
+	Stop()
+	// String returns the full name of the destination
+	String() string
+}
+
+// publishResult is the result of a publish, Get blocking until the message
+// is published or failed to be. It is implemented by *pubsub.PublishResult.
+type publishResult interface {
+	Get(ctx context.Context) (serverID string, err error)
+}
+
+// rejectedError is the publish error of a message that can never be
+// published to its destination, e.g. a malformed row, which is dead-lettered
+// or dropped instead of being retried
+type rejectedError struct {
+	err error
+}
+
+func (e *rejectedError) Error() string {
+	return e.err.Error()
+}
+
+func (e *rejectedError) Unwrap() error {
+	return e.err
+}
+
+// topicPublisher publishes messages to a pubsub topic
+type topicPublisher struct {
+	*pubsub.Topic
+}
+
+func (p topicPublisher) Publish(ctx context.Context, msg *pubsub.Message) publishResult {
+	return p.Topic.Publish(ctx, msg)
+}
+
+// litePublisher is a pubsub lite publisher client named after its topic
+type litePublisher struct {
+	*pscompat.PublisherClient
+	path string
+}
+
+func (p *litePublisher) Publish(ctx context.Context, msg *pubsub.Message) publishResult {
+	return p.PublisherClient.Publish(ctx, msg)
+}
+
+func (p *litePublisher) String() string {
+	return p.path
+}
+
+// newLitePublisher creates a publisher for a pubsub lite topic, location
+// being the region or zone of the topic
+func newLitePublisher(ctx context.Context, project, location, topic string, opts ...option.ClientOption) (publisher, error) {
+	path := fmt.Sprintf("projects/%s/locations/%s/topics/%s", project, location, topic)
+	client, err := pscompat.NewPublisherClient(ctx, path, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return &litePublisher{PublisherClient: client, path: path}, nil
+}
+
+// fan-out modes, deciding whether a message published to some of its topics
+// only is acked
+const (
+	FanOutModeAll = "all"
+	FanOutModeAny = "any"
+)
+
+// ack modes, deciding when a forwarded message is acked
+const (
+	// AckModeOnSuccess acks messages once their publish is confirmed and
+	// nacks them otherwise, delivering them at least once
+	AckModeOnSuccess = "on-success"
+	// AckModeBeforePublish acks messages before publishing them, a failed
+	// publish drops the message, delivering them at most once
+	AckModeBeforePublish = "before-publish"
+	// AckModeAlways acks messages once their publish completes, whether it
+	// failed or not
+	AckModeAlways = "always"
+)
+
+// flowControlBehaviors maps the flow control behavior names to the behavior
+// of the publisher when its flow control limits are exceeded
+var flowControlBehaviors = map[string]pubsub.LimitExceededBehavior{
+	FlowControlBlock:       pubsub.FlowControlBlock,
+	FlowControlIgnore:      pubsub.FlowControlIgnore,
+	FlowControlSignalError: pubsub.FlowControlSignalError,
+}
+
+// PublishProfile is a named set of publish settings of the destination
+// topics of the mappings referencing it. Zero values keep the global
+// settings.
+type PublishProfile struct {
+	CountThreshold         int           `mapstructure:"publish-count-threshold"`
+	ByteThreshold          int           `mapstructure:"publish-byte-threshold"`
+	DelayThreshold         time.Duration `mapstructure:"publish-delay-threshold"`
+	FlowControlBehavior    string        `mapstructure:"flow-control-behavior"`
+	FlowControlMaxMessages int           `mapstructure:"flow-control-max-messages"`
+	FlowControlMaxBytes    int           `mapstructure:"flow-control-max-bytes"`
+}
+
+// apply overrides the publish settings of t with the non-zero settings of
+// the profile
+func (p PublishProfile) apply(t *pubsub.Topic) {
+	if p.CountThreshold > 0 {
+		t.PublishSettings.CountThreshold = p.CountThreshold
+	}
+	if p.ByteThreshold > 0 {
+		t.PublishSettings.ByteThreshold = p.ByteThreshold
+	}
+	if p.DelayThreshold > 0 {
+		t.PublishSettings.DelayThreshold = p.DelayThreshold
+	}
+	if p.FlowControlBehavior != "" {
+		t.PublishSettings.FlowControlSettings.LimitExceededBehavior = flowControlBehaviors[p.FlowControlBehavior]
+	}
+	if p.FlowControlMaxMessages > 0 {
+		t.PublishSettings.FlowControlSettings.MaxOutstandingMessages = p.FlowControlMaxMessages
+	}
+	if p.FlowControlMaxBytes > 0 {
+		t.PublishSettings.FlowControlSettings.MaxOutstandingBytes = p.FlowControlMaxBytes
+	}
+}
+
+// resumePublish resumes publishing of an ordering key after a failed
+// publish. Pubsub pauses a key when one of its messages fails to publish, so
+// every later message of the key would fail until it is resumed.
+func resumePublish(p publisher, key string) {
+	if key == "" {
+		return
+	}
+	if r, ok := p.(interface{ ResumePublish(key string) }); ok {
+		r.ResumePublish(key)
+	}
+}
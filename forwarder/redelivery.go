@@ -0,0 +1,58 @@
+package forwarder
+
+import (
+	"container/list"
+	"sync"
+	"time"
+)
+
+// redeliveryTracker remembers when the IDs of received messages were first
+// seen to detect their redeliveries, e.g. when the ack deadline of a message
+// expires while it is still being published. It holds at most size IDs, the
+// first seen being evicted first.
+type redeliveryTracker struct {
+	size int
+
+	mu      sync.Mutex
+	entries map[string]*list.Element
+	// order lists the entries from the most to the least recently first seen
+	order *list.List
+}
+
+type redeliveryEntry struct {
+	id         string
+	firstSeen  time.Time
+	deliveries int
+}
+
+func newRedeliveryTracker(size int) *redeliveryTracker {
+	return &redeliveryTracker{
+		size:    size,
+		entries: map[string]*list.Element{},
+		order:   list.New(),
+	}
+}
+
+// observe records a delivery of the message id and reports whether it was
+// already seen, with the time since it was first seen and its number of
+// deliveries so far
+func (t *redeliveryTracker) observe(id string) (redelivered bool, sinceFirstSeen time.Duration, deliveries int) {
+	if id == "" {
+		return false, 0, 0
+	}
+	now := time.Now()
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if e, ok := t.entries[id]; ok {
+		entry := e.Value.(*redeliveryEntry)
+		entry.deliveries++
+		return true, now.Sub(entry.firstSeen), entry.deliveries
+	}
+	t.entries[id] = t.order.PushFront(&redeliveryEntry{id: id, firstSeen: now, deliveries: 1})
+	for t.order.Len() > t.size {
+		oldest := t.order.Back()
+		t.order.Remove(oldest)
+		delete(t.entries, oldest.Value.(*redeliveryEntry).id)
+	}
+	return false, 0, 1
+}
@@ -0,0 +1,71 @@
+package forwarder
+
+import (
+	"strings"
+
+	"cloud.google.com/go/pubsub"
+)
+
+// resource collections of fully-qualified names
+const (
+	collectionSubscriptions = "subscriptions"
+	collectionTopics        = "topics"
+)
+
+// parseResource splits name, a short name or a fully-qualified
+// projects/<project>/<collection>/<name> resource name. The project is empty
+// for a short name, ok is false for a malformed fully-qualified one.
+func parseResource(name, collection string) (project, id string, ok bool) {
+	if !strings.HasPrefix(name, "projects/") {
+		return "", name, true
+	}
+	parts := strings.Split(name, "/")
+	if len(parts) != 4 || parts[1] == "" || parts[2] != collection || parts[3] == "" {
+		return "", "", false
+	}
+	return parts[1], parts[3], true
+}
+
+// SubscriptionIn returns the subscription of name using client, in the
+// project of name when it is fully-qualified and in the client project
+// otherwise
+func SubscriptionIn(client *pubsub.Client, name string) *pubsub.Subscription {
+	if project, id, _ := parseResource(name, collectionSubscriptions); project != "" {
+		return client.SubscriptionInProject(id, project)
+	}
+	return client.Subscription(name)
+}
+
+// TopicIn returns the topic of name using client, in the project of name
+// when it is fully-qualified and in the client project otherwise
+func TopicIn(client *pubsub.Client, name string) *pubsub.Topic {
+	if project, id, _ := parseResource(name, collectionTopics); project != "" {
+		return client.TopicInProject(id, project)
+	}
+	return client.Topic(name)
+}
+
+// SourceProject returns the project of the source client, the project of
+// the fully-qualified subscription when FromGoogleCloudProject is not set
+func (m Mapping) SourceProject() string {
+	if m.FromGoogleCloudProject != "" {
+		return m.FromGoogleCloudProject
+	}
+	project, _, _ := parseResource(m.PubSubSubscription, collectionSubscriptions)
+	return project
+}
+
+// DestinationProject returns the project of the destination client, the
+// project of the first fully-qualified destination topic when
+// ToGoogleCloudProject is not set
+func (m Mapping) DestinationProject() string {
+	if m.ToGoogleCloudProject != "" {
+		return m.ToGoogleCloudProject
+	}
+	for _, name := range m.DestinationTopics() {
+		if project, _, _ := parseResource(name, collectionTopics); project != "" {
+			return project
+		}
+	}
+	return ""
+}
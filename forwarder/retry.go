@@ -0,0 +1,67 @@
+package forwarder
+
+import (
+	"context"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// backoff computes capped exponential delays between attempts
+type backoff struct {
+	initial time.Duration
+	max     time.Duration
+}
+
+// delay returns the time to wait after the given failed attempt, starting at 1
+func (b backoff) delay(attempt int) time.Duration {
+	d := b.initial
+	for i := 1; i < attempt && d < b.max; i++ {
+		d *= 2
+	}
+	if d > b.max {
+		d = b.max
+	}
+	return d
+}
+
+// sleep waits for d or until ctx is done, in which case the ctx error is returned
+func sleep(ctx context.Context, d time.Duration) error {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-t.C:
+		return nil
+	}
+}
+
+// retryPolicy configures how many times a publish is attempted before nacking
+type retryPolicy struct {
+	maxAttempts int
+	backoff     backoff
+}
+
+// isUnauthorized reports whether err is caused by credentials that are not
+// accepted, e.g. an expired token that could not be refreshed
+func isUnauthorized(err error) bool {
+	switch status.Code(err) {
+	case codes.Unauthenticated, codes.PermissionDenied:
+		return true
+	default:
+		return false
+	}
+}
+
+// isPermanent reports whether err is caused by the configuration or the
+// permissions, in which case retrying can not succeed
+func isPermanent(err error) bool {
+	switch status.Code(err) {
+	case codes.PermissionDenied, codes.Unauthenticated, codes.NotFound, codes.InvalidArgument, codes.FailedPrecondition:
+		return true
+	default:
+		return false
+	}
+}
@@ -0,0 +1,66 @@
+package forwarder
+
+import (
+	"strings"
+	"sync"
+
+	"cloud.google.com/go/pubsub"
+)
+
+// topicRouter resolves the destination topic of a message from one of its
+// attributes, caching the topic handles so they are created once per topic
+type topicRouter struct {
+	attribute string
+	// template is the topic name, where {<attribute>} is replaced by the
+	// attribute value. The attribute value is the topic name when it is empty.
+	template  string
+	client    *pubsub.Client
+	configure func(*pubsub.Topic)
+
+	mu     sync.Mutex
+	topics map[string]*pubsub.Topic
+}
+
+func newTopicRouter(client *pubsub.Client, attribute, template string, configure func(*pubsub.Topic)) *topicRouter {
+	return &topicRouter{
+		attribute: attribute,
+		template:  template,
+		client:    client,
+		configure: configure,
+		topics:    map[string]*pubsub.Topic{},
+	}
+}
+
+// route returns the topic of a message holding attrs, false when the
+// routing attribute is missing
+func (r *topicRouter) route(attrs map[string]string) (*pubsub.Topic, bool) {
+	value, ok := attrs[r.attribute]
+	if !ok || value == "" {
+		return nil, false
+	}
+	name := value
+	if r.template != "" {
+		name = strings.ReplaceAll(r.template, "{"+r.attribute+"}", value)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	topic, ok := r.topics[name]
+	if !ok {
+		topic = TopicIn(r.client, name)
+		if r.configure != nil {
+			r.configure(topic)
+		}
+		r.topics[name] = topic
+	}
+	return topic, true
+}
+
+// stop flushes and stops every topic handle created by the router
+func (r *topicRouter) stop() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, topic := range r.topics {
+		topic.Stop()
+	}
+}
@@ -0,0 +1,49 @@
+package forwarder
+
+import (
+	"hash/fnv"
+	"math"
+	"math/rand"
+
+	"cloud.google.com/go/pubsub"
+)
+
+// sampler forwards a fraction of the messages, picked at random or, when
+// deterministic, from a hash of their ID or attribute so that a redelivered
+// message gets the same decision, even after a restart
+type sampler struct {
+	rate          float64
+	deterministic bool
+	// attribute is hashed instead of the ID when set, messages without it
+	// being sampled on their ID
+	attribute string
+}
+
+func newSampler(rate float64, deterministic bool, attribute string) *sampler {
+	return &sampler{rate: rate, deterministic: deterministic, attribute: attribute}
+}
+
+// keep reports whether msg is part of the sample
+func (s *sampler) keep(msg *pubsub.Message) bool {
+	if !s.deterministic {
+		return rand.Float64() < s.rate
+	}
+	key := msg.ID
+	if v, ok := msg.Attributes[s.attribute]; ok && s.attribute != "" {
+		key = v
+	}
+	h := fnv.New64a()
+	_, _ = h.Write([]byte(key))
+	return float64(mix(h.Sum64())) < s.rate*math.MaxUint64
+}
+
+// mix spreads the bits of h, the high bits of FNV hashes of short keys being
+// close to each other, with the murmur3 finalizer
+func mix(h uint64) uint64 {
+	h ^= h >> 33
+	h *= 0xff51afd7ed558ccd
+	h ^= h >> 33
+	h *= 0xc4ceb9fe1a85ec53
+	h ^= h >> 33
+	return h
+}
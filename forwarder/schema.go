@@ -0,0 +1,136 @@
+package forwarder
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/jhump/protoreflect/desc"
+	"github.com/jhump/protoreflect/desc/protoparse"
+	"github.com/linkedin/goavro/v2"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+// schema encodings, as for pubsub topic schemas
+const (
+	SchemaEncodingJSON   = "json"
+	SchemaEncodingBinary = "binary"
+)
+
+// schemaValidator validates message data against a protobuf or Avro schema
+type schemaValidator interface {
+	validate(data []byte) error
+}
+
+// newSchemaValidator loads the schema of path, a protobuf schema when it
+// has the .proto extension and an Avro schema otherwise, for data of the
+// given encoding
+func newSchemaValidator(path, encoding string) (schemaValidator, error) {
+	if strings.EqualFold(filepath.Ext(path), ".proto") {
+		return newProtoValidator(path, encoding)
+	}
+	return newAvroValidator(path, encoding)
+}
+
+// protoValidator validates data against the first message type of a
+// protobuf schema, pubsub schemas holding a single top-level message
+type protoValidator struct {
+	message protoreflect.MessageDescriptor
+	json    bool
+}
+
+func newProtoValidator(path, encoding string) (*protoValidator, error) {
+	parser := protoparse.Parser{ImportPaths: []string{filepath.Dir(path)}}
+	files, err := parser.ParseFiles(filepath.Base(path))
+	if err != nil {
+		return nil, err
+	}
+	messages := files[0].GetMessageTypes()
+	if len(messages) == 0 {
+		return nil, fmt.Errorf("%s defines no message type", path)
+	}
+
+	// the parsed files are converted to the descriptors of the protobuf
+	// runtime, along with their imports
+	set := &descriptorpb.FileDescriptorSet{}
+	seen := map[string]bool{}
+	var add func(fd *desc.FileDescriptor)
+	add = func(fd *desc.FileDescriptor) {
+		if seen[fd.GetName()] {
+			return
+		}
+		seen[fd.GetName()] = true
+		for _, dep := range fd.GetDependencies() {
+			add(dep)
+		}
+		set.File = append(set.File, fd.AsFileDescriptorProto())
+	}
+	add(files[0])
+	registry, err := protodesc.NewFiles(set)
+	if err != nil {
+		return nil, err
+	}
+	d, err := registry.FindDescriptorByName(protoreflect.FullName(messages[0].GetFullyQualifiedName()))
+	if err != nil {
+		return nil, err
+	}
+	return &protoValidator{message: d.(protoreflect.MessageDescriptor), json: encoding == SchemaEncodingJSON}, nil
+}
+
+func (v *protoValidator) validate(data []byte) error {
+	msg := dynamicpb.NewMessage(v.message)
+	if v.json {
+		return protojson.Unmarshal(data, msg)
+	}
+	if err := proto.Unmarshal(data, msg); err != nil {
+		return err
+	}
+	// unknown fields are data the schema does not describe
+	if len(msg.GetUnknown()) > 0 {
+		return fmt.Errorf("data holds fields unknown to message %s", v.message.FullName())
+	}
+	return nil
+}
+
+// avroValidator validates data against an Avro schema
+type avroValidator struct {
+	codec *goavro.Codec
+	json  bool
+}
+
+func newAvroValidator(path, encoding string) (*avroValidator, error) {
+	schema, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	codec, err := goavro.NewCodec(string(schema))
+	if err != nil {
+		return nil, err
+	}
+	return &avroValidator{codec: codec, json: encoding == SchemaEncodingJSON}, nil
+}
+
+func (v *avroValidator) validate(data []byte) error {
+	var (
+		rest []byte
+		err  error
+	)
+	if v.json {
+		_, rest, err = v.codec.NativeFromTextual(data)
+	} else {
+		_, rest, err = v.codec.NativeFromBinary(data)
+	}
+	if err != nil {
+		return err
+	}
+	if len(strings.TrimSpace(string(rest))) > 0 {
+		return fmt.Errorf("%d bytes remain after the %s record", len(rest), v.codec.Schema())
+	}
+	return nil
+}
@@ -0,0 +1,69 @@
+package forwarder
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+
+	"google.golang.org/api/option"
+	"google.golang.org/grpc"
+	grpccredentials "google.golang.org/grpc/credentials"
+)
+
+// endpointOptions returns the client options to reach pubsub through a
+// custom endpoint, optionally trusting a custom CA bundle and presenting a
+// client certificate when the endpoint requires mutual TLS
+func endpointOptions(endpoint, caCertFile, clientCertFile, clientKeyFile string) ([]option.ClientOption, error) {
+	var opts []option.ClientOption
+	if endpoint != "" {
+		opts = append(opts, option.WithEndpoint(endpoint))
+	}
+	if caCertFile == "" && clientCertFile == "" && clientKeyFile == "" {
+		return opts, nil
+	}
+
+	tlsConfig := &tls.Config{MinVersion: tls.VersionTLS12}
+
+	if caCertFile != "" {
+		pool, err := caCertPool(caCertFile)
+		if err != nil {
+			return nil, err
+		}
+		tlsConfig.RootCAs = pool
+	}
+
+	// the files are set together and exist, checked by Validate
+	if clientCertFile != "" {
+		cert, err := tls.LoadX509KeyPair(clientCertFile, clientKeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("could not load client certificate: %v", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+
+	return append(opts, option.WithGRPCDialOption(grpc.WithTransportCredentials(grpccredentials.NewTLS(tlsConfig)))), nil
+}
+
+// serverTLSConfig returns the TLS configuration of the metrics, health and
+// admin servers presenting the certificate of certFile and keyFile
+func serverTLSConfig(certFile, keyFile string) (*tls.Config, error) {
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return nil, err
+	}
+	return &tls.Config{MinVersion: tls.VersionTLS12, Certificates: []tls.Certificate{cert}}, nil
+}
+
+// caCertPool returns the pool of the certificates of the PEM CA bundle file
+func caCertPool(caCertFile string) (*x509.CertPool, error) {
+	pem, err := ioutil.ReadFile(caCertFile)
+	if err != nil {
+		return nil, fmt.Errorf("could not read CA certificate file: %v", err)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(pem) {
+		return nil, fmt.Errorf("no certificate found in CA certificate file %s", caCertFile)
+	}
+	return pool, nil
+}
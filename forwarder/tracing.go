@@ -0,0 +1,76 @@
+package forwarder
+
+import (
+	"context"
+
+	"cloud.google.com/go/pubsub"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
+	"go.opentelemetry.io/otel/propagation"
+	sdkresource "go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.7.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const tracerName = "github.com/karnott/pubsub-to-pubsub"
+
+// propagator reads and writes the trace context of messages in their
+// traceparent and tracestate attributes
+var propagator = propagation.TraceContext{}
+
+// setupTracing exports spans over OTLP to endpoint and returns the function
+// flushing them on shutdown, version being the reported service version.
+// Until it is called, spans are no-ops.
+func setupTracing(ctx context.Context, endpoint string, insecure bool, version string) (func(context.Context) error, error) {
+	opts := []otlptracegrpc.Option{otlptracegrpc.WithEndpoint(endpoint)}
+	if insecure {
+		opts = append(opts, otlptracegrpc.WithInsecure())
+	}
+	exporter, err := otlptracegrpc.New(ctx, opts...)
+	if err != nil {
+		return nil, err
+	}
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(sdkresource.NewWithAttributes(
+			semconv.SchemaURL,
+			semconv.ServiceNameKey.String("pubsub-to-pubsub"),
+			semconv.ServiceVersionKey.String(version),
+		)),
+	)
+	otel.SetTracerProvider(provider)
+	return provider.Shutdown, nil
+}
+
+// startSpan starts the span of the publish of out, child of the trace context
+// of the received msg, and injects its context in the attributes of out
+func (f *forwarder) startSpan(ctx context.Context, msg, out *pubsub.Message) (context.Context, trace.Span) {
+	ctx = propagator.Extract(ctx, propagation.MapCarrier(msg.Attributes))
+	ctx, span := otel.Tracer(tracerName).Start(ctx, "forward "+f.mapping.PubSubSubscription,
+		trace.WithSpanKind(trace.SpanKindProducer),
+		trace.WithAttributes(
+			semconv.MessagingSystemKey.String("pubsub"),
+			semconv.MessagingDestinationKey.String(f.mapping.PubSubDestinationTopic),
+			semconv.MessagingMessageIDKey.String(msg.ID),
+			attribute.String("messaging.source", f.mapping.PubSubSubscription),
+		),
+	)
+	if out.Attributes == nil {
+		out.Attributes = map[string]string{}
+	}
+	propagator.Inject(ctx, propagation.MapCarrier(out.Attributes))
+	return ctx, span
+}
+
+// endSpan ends the span of ctx, recording err if the publish failed
+func endSpan(ctx context.Context, err error) {
+	span := trace.SpanFromContext(ctx)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
@@ -0,0 +1,108 @@
+package forwarder
+
+import (
+	"fmt"
+	"reflect"
+
+	"cloud.google.com/go/pubsub"
+	"github.com/google/cel-go/cel"
+	"github.com/google/cel-go/checker/decls"
+	"github.com/google/cel-go/common/types"
+	"github.com/google/cel-go/common/types/ref"
+	"github.com/google/cel-go/common/types/traits"
+)
+
+// keys of the map returned by a CEL transform
+const (
+	celResultData       = "data"
+	celResultAttributes = "attributes"
+)
+
+var attributesType = reflect.TypeOf(map[string]string{})
+
+// celTransform rewrites messages with a CEL expression. The expression sees
+// the message as `data` (bytes), `text` (data as a string) and `attributes`,
+// and returns a map with an optional `data` entry (bytes or string) replacing
+// the payload and an optional `attributes` entry merged into the attributes.
+type celTransform struct {
+	program cel.Program
+}
+
+// newCELTransform compiles expr, failing on syntax or type errors
+func newCELTransform(expr string) (*celTransform, error) {
+	env, err := cel.NewEnv(cel.Declarations(
+		decls.NewVar("data", decls.Bytes),
+		decls.NewVar("text", decls.String),
+		decls.NewVar("attributes", decls.NewMapType(decls.String, decls.String)),
+	))
+	if err != nil {
+		return nil, err
+	}
+	ast, iss := env.Compile(expr)
+	if iss.Err() != nil {
+		return nil, iss.Err()
+	}
+	if rt := ast.ResultType(); rt.GetMapType() == nil && rt.GetDyn() == nil {
+		return nil, fmt.Errorf("expression must return a map, got %s", cel.FormatType(rt))
+	}
+	program, err := env.Program(ast)
+	if err != nil {
+		return nil, err
+	}
+	return &celTransform{program: program}, nil
+}
+
+// apply evaluates the expression against msg and updates it in place
+func (t *celTransform) apply(msg *pubsub.Message) error {
+	attrs := msg.Attributes
+	if attrs == nil {
+		attrs = map[string]string{}
+	}
+	out, _, err := t.program.Eval(map[string]interface{}{
+		"data":       msg.Data,
+		"text":       string(msg.Data),
+		"attributes": attrs,
+	})
+	if err != nil {
+		return err
+	}
+	result, ok := out.(traits.Mapper)
+	if !ok {
+		return fmt.Errorf("expression returned %s instead of a map", out.Type().TypeName())
+	}
+
+	if v, found := result.Find(types.String(celResultData)); found {
+		data, err := celBytes(v)
+		if err != nil {
+			return err
+		}
+		msg.Data = data
+	}
+
+	if v, found := result.Find(types.String(celResultAttributes)); found {
+		native, err := v.ConvertToNative(attributesType)
+		if err != nil {
+			return fmt.Errorf("invalid %s: %v", celResultAttributes, err)
+		}
+		merged := make(map[string]string, len(msg.Attributes))
+		for k, v := range msg.Attributes {
+			merged[k] = v
+		}
+		for k, v := range native.(map[string]string) {
+			merged[k] = v
+		}
+		msg.Attributes = merged
+	}
+	return nil
+}
+
+func celBytes(v ref.Val) ([]byte, error) {
+	switch d := v.(type) {
+	case types.Bytes:
+		return []byte(d), nil
+	case types.String:
+		return []byte(d), nil
+	default:
+		return nil, fmt.Errorf("invalid %s: expected bytes or string, got %s", celResultData, v.Type().TypeName())
+	}
+}
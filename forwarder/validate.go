@@ -0,0 +1,489 @@
+package forwarder
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+
+	"cloud.google.com/go/pubsub"
+	"golang.org/x/oauth2/google"
+)
+
+// minGRPCKeepaliveTime is the shortest keepalive time accepted, google
+// servers closing connections that ping more often
+const minGRPCKeepaliveTime = 30 * time.Second
+
+// maxNackDelay bounds the nack delay, held messages counting against the
+// flow control limits and their ack deadline being extended meanwhile
+const maxNackDelay = 10 * time.Minute
+
+// Validate returns every problem found in the configuration, without
+// connecting to pubsub
+func (cfg *Config) Validate() []string {
+	problems := cfg.ValidateMappings()
+
+	if cfg.FromGoogleApplicationCredentials != "" && cfg.FromGoogleApplicationCredentialsFile != "" {
+		problems = append(problems, "FROM_GOOGLE_APPLICATION_CREDENTIALS_JSON and FROM_GOOGLE_APPLICATION_CREDENTIALS_FILE variables are mutually exclusive.")
+	}
+	if cfg.ToGoogleApplicationCredentials != "" && cfg.ToGoogleApplicationCredentialsFile != "" {
+		problems = append(problems, "TO_GOOGLE_APPLICATION_CREDENTIALS_JSON and TO_GOOGLE_APPLICATION_CREDENTIALS_FILE variables are mutually exclusive.")
+	}
+
+	if cfg.PublishCountThreshold < 1 || cfg.PublishCountThreshold > pubsub.MaxPublishRequestCount {
+		problems = append(problems, fmt.Sprintf("PUBLISH_COUNT_THRESHOLD must be between 1 and %d, got %d.", pubsub.MaxPublishRequestCount, cfg.PublishCountThreshold))
+	}
+	if cfg.PublishByteThreshold < 1 {
+		problems = append(problems, fmt.Sprintf("PUBLISH_BYTE_THRESHOLD must be positive, got %d.", cfg.PublishByteThreshold))
+	}
+
+	if cfg.MaxOutstandingMessages == 0 || cfg.MaxOutstandingMessages < -1 {
+		problems = append(problems, fmt.Sprintf("MAX_OUTSTANDING_MESSAGES must be positive or -1 for unlimited, got %d.", cfg.MaxOutstandingMessages))
+	}
+	if cfg.MaxOutstandingBytes == 0 || cfg.MaxOutstandingBytes < -1 {
+		problems = append(problems, fmt.Sprintf("MAX_OUTSTANDING_BYTES must be positive or -1 for unlimited, got %d.", cfg.MaxOutstandingBytes))
+	}
+
+	if cfg.DeadLetterTopic != "" && cfg.MaxPublishRetries < 1 {
+		problems = append(problems, fmt.Sprintf("MAX_PUBLISH_RETRIES must be at least 1, got %d.", cfg.MaxPublishRetries))
+	}
+
+	if cfg.ReceiveMaxRetries < 0 {
+		problems = append(problems, fmt.Sprintf("RECEIVE_MAX_RETRIES must be positive or 0 for unlimited, got %d.", cfg.ReceiveMaxRetries))
+	}
+	if cfg.ReceiveAuthRetries < 0 {
+		problems = append(problems, fmt.Sprintf("RECEIVE_AUTH_RETRIES must be positive or 0 to fail right away, got %d.", cfg.ReceiveAuthRetries))
+	}
+
+	if cfg.MaxMessageBytes < 0 {
+		problems = append(problems, fmt.Sprintf("MAX_MESSAGE_BYTES must be positive or 0 for unlimited, got %d.", cfg.MaxMessageBytes))
+	}
+
+	if cfg.ReceiveGoroutines < 1 {
+		problems = append(problems, fmt.Sprintf("RECEIVE_GOROUTINES must be at least 1, got %d.", cfg.ReceiveGoroutines))
+	}
+
+	if cfg.MaxPublishRate < 0 {
+		problems = append(problems, fmt.Sprintf("MAX_PUBLISH_RATE must be positive or 0 for unlimited, got %g.", cfg.MaxPublishRate))
+	}
+	if cfg.MaxPublishRate > 0 && cfg.PublishBurst < 1 {
+		problems = append(problems, fmt.Sprintf("PUBLISH_BURST must be at least 1, got %d.", cfg.PublishBurst))
+	}
+
+	if cfg.DedupWindow < 0 {
+		problems = append(problems, fmt.Sprintf("DEDUP_WINDOW must be positive or 0 to disable deduplication, got %s.", cfg.DedupWindow))
+	}
+	if cfg.DedupWindow > 0 && cfg.DedupSize < 1 {
+		problems = append(problems, fmt.Sprintf("DEDUP_SIZE must be at least 1, got %d.", cfg.DedupSize))
+	}
+
+	if cfg.PublishTimeout < 0 {
+		problems = append(problems, fmt.Sprintf("PUBLISH_TIMEOUT must be positive or 0 for unlimited, got %s.", cfg.PublishTimeout))
+	}
+
+	if cfg.ErrorLogSample != "" {
+		if _, err := parseErrorLogSample(cfg.ErrorLogSample); err != nil {
+			problems = append(problems, fmt.Sprintf("ERROR_LOG_SAMPLE must be first:every, e.g. 10:100, got %q.", cfg.ErrorLogSample))
+		}
+	}
+
+	if cfg.RunDuration < 0 {
+		problems = append(problems, fmt.Sprintf("RUN_DURATION must be positive or 0 to run until stopped, got %s.", cfg.RunDuration))
+	}
+
+	for _, c := range []struct {
+		env, secret, json, file string
+	}{
+		{"FROM_CREDENTIALS_SECRET", cfg.FromCredentialsSecret, cfg.FromGoogleApplicationCredentials, cfg.FromGoogleApplicationCredentialsFile},
+		{"TO_CREDENTIALS_SECRET", cfg.ToCredentialsSecret, cfg.ToGoogleApplicationCredentials, cfg.ToGoogleApplicationCredentialsFile},
+	} {
+		if c.secret == "" {
+			continue
+		}
+		if !isSecretVersion(c.secret) {
+			problems = append(problems, fmt.Sprintf("%s must be projects/<project>/secrets/<secret>/versions/<version>, got %q.", c.env, c.secret))
+		}
+		if c.json != "" || c.file != "" {
+			problems = append(problems, fmt.Sprintf("%s can not be combined with JSON credentials or a credentials file.", c.env))
+		}
+	}
+
+	if cfg.CircuitFailureThreshold < 0 {
+		problems = append(problems, fmt.Sprintf("CIRCUIT_FAILURE_THRESHOLD must be positive or 0 to disable the circuit breaker, got %d.", cfg.CircuitFailureThreshold))
+	}
+	if cfg.CircuitFailureThreshold > 0 && cfg.CircuitResetTimeout <= 0 {
+		problems = append(problems, fmt.Sprintf("CIRCUIT_RESET_TIMEOUT must be positive, got %s.", cfg.CircuitResetTimeout))
+	}
+
+	if cfg.BacklogLogInterval < 0 {
+		problems = append(problems, fmt.Sprintf("BACKLOG_LOG_INTERVAL must be positive or 0 to never log the backlog, got %s.", cfg.BacklogLogInterval))
+	}
+
+	if cfg.DrainIdle < 0 {
+		problems = append(problems, fmt.Sprintf("DRAIN_IDLE must be positive or 0 to run until stopped, got %s.", cfg.DrainIdle))
+	}
+	if (cfg.AdminTLSCert == "") != (cfg.AdminTLSKey == "") {
+		problems = append(problems, "ADMIN_TLS_CERT and ADMIN_TLS_KEY must be set together.")
+	}
+	if (cfg.ClientCertFile == "") != (cfg.ClientKeyFile == "") {
+		problems = append(problems, "CLIENT_CERT_FILE and CLIENT_KEY_FILE must be set together.")
+	}
+	for _, c := range []struct {
+		env, file string
+	}{
+		{"CA_CERT_FILE", cfg.CACertFile},
+		{"CLIENT_CERT_FILE", cfg.ClientCertFile},
+		{"CLIENT_KEY_FILE", cfg.ClientKeyFile},
+	} {
+		if c.file == "" {
+			continue
+		}
+		if _, err := os.Stat(c.file); err != nil {
+			problems = append(problems, fmt.Sprintf("%s must be an existing file, got %q.", c.env, c.file))
+		}
+	}
+	if cfg.MaxMessages < 0 {
+		problems = append(problems, fmt.Sprintf("MAX_MESSAGES must be positive or 0 to run until stopped, got %d.", cfg.MaxMessages))
+	}
+	if cfg.MaxBytes < 0 {
+		problems = append(problems, fmt.Sprintf("MAX_BYTES must be positive or 0 to run until stopped, got %d.", cfg.MaxBytes))
+	}
+
+	if cfg.MaxMessageAgeWarn < 0 {
+		problems = append(problems, fmt.Sprintf("MAX_MESSAGE_AGE_WARN must be positive or 0 to never warn, got %s.", cfg.MaxMessageAgeWarn))
+	}
+	if cfg.RedeliveryTrackSize < 0 {
+		problems = append(problems, fmt.Sprintf("REDELIVERY_TRACK_SIZE must be positive or 0 to disable redelivery detection, got %d.", cfg.RedeliveryTrackSize))
+	}
+	if cfg.RedeliveryWarn < 0 {
+		problems = append(problems, fmt.Sprintf("REDELIVERY_WARN must be positive or 0 to never warn, got %s.", cfg.RedeliveryWarn))
+	}
+
+	if cfg.GRPCKeepaliveTime < 0 || cfg.GRPCKeepaliveTime > 0 && cfg.GRPCKeepaliveTime < minGRPCKeepaliveTime {
+		problems = append(problems, fmt.Sprintf("GRPC_KEEPALIVE_TIME must be at least %s or 0 for the client default, got %s.", minGRPCKeepaliveTime, cfg.GRPCKeepaliveTime))
+	}
+	if cfg.GRPCConnectionPool < 0 {
+		problems = append(problems, fmt.Sprintf("GRPC_CONNECTION_POOL must be positive or 0 for the client default, got %d.", cfg.GRPCConnectionPool))
+	}
+	if cfg.GRPCKeepaliveTimeout < 0 {
+		problems = append(problems, fmt.Sprintf("GRPC_KEEPALIVE_TIMEOUT must be positive or 0 for the client default, got %s.", cfg.GRPCKeepaliveTimeout))
+	}
+
+	if cfg.PublishConcurrency < 0 {
+		problems = append(problems, fmt.Sprintf("PUBLISH_CONCURRENCY must be positive or 0 for unlimited, got %d.", cfg.PublishConcurrency))
+	}
+
+	if cfg.IgnoreOrdering && cfg.OrderingKeyAttribute != "" {
+		problems = append(problems, "IGNORE_ORDERING and ORDERING_KEY_ATTRIBUTE can not be used together.")
+	}
+	if cfg.IgnoreOrdering && cfg.MaxInflightPerKey > 0 {
+		problems = append(problems, "MAX_INFLIGHT_PER_KEY can not be used with IGNORE_ORDERING, messages being published without ordering key.")
+	}
+	if cfg.MaxInflightPerKey < 0 {
+		problems = append(problems, fmt.Sprintf("MAX_INFLIGHT_PER_KEY must be positive or 0 for unlimited, got %d.", cfg.MaxInflightPerKey))
+	}
+
+	if cfg.NackDelay < 0 || cfg.NackDelay > maxNackDelay {
+		problems = append(problems, fmt.Sprintf("NACK_DELAY must be between 0 and %s, got %s.", maxNackDelay, cfg.NackDelay))
+	}
+
+	if cfg.PublishMaxAttempts < 1 {
+		problems = append(problems, fmt.Sprintf("PUBLISH_MAX_ATTEMPTS must be at least 1, got %d.", cfg.PublishMaxAttempts))
+	}
+
+	switch cfg.DestinationType {
+	case DestinationTypePubSub:
+	case DestinationTypePubSubLite:
+		if cfg.PubSubLiteLocation == "" {
+			problems = append(problems, fmt.Sprintf("PUBSUBLITE_LOCATION variable must be set when DESTINATION_TYPE is %s.", DestinationTypePubSubLite))
+		}
+		if cfg.EmulatorHost != "" {
+			problems = append(problems, fmt.Sprintf("EMULATOR_HOST can not be used with DESTINATION_TYPE %s.", DestinationTypePubSubLite))
+		}
+		if cfg.DynamicTopicAttribute != "" {
+			problems = append(problems, fmt.Sprintf("DYNAMIC_TOPIC_ATTRIBUTE can not be used with DESTINATION_TYPE %s.", DestinationTypePubSubLite))
+		}
+	case DestinationTypeFile:
+		if cfg.DestinationFile == "" {
+			problems = append(problems, fmt.Sprintf("DESTINATION_FILE variable must be set when DESTINATION_TYPE is %s.", DestinationTypeFile))
+		}
+		if cfg.DynamicTopicAttribute != "" {
+			problems = append(problems, fmt.Sprintf("DYNAMIC_TOPIC_ATTRIBUTE can not be used with DESTINATION_TYPE %s.", DestinationTypeFile))
+		}
+		if cfg.DestinationFileMaxBytes < 0 {
+			problems = append(problems, fmt.Sprintf("DESTINATION_FILE_MAX_BYTES must be positive or 0 to never rotate, got %d.", cfg.DestinationFileMaxBytes))
+		}
+	case DestinationTypeBigQuery:
+		if cfg.BigQueryDataset == "" || cfg.BigQueryTable == "" {
+			problems = append(problems, fmt.Sprintf("BQ_DATASET and BQ_TABLE variables must be set when DESTINATION_TYPE is %s.", DestinationTypeBigQuery))
+		}
+		if cfg.EmulatorHost != "" {
+			problems = append(problems, fmt.Sprintf("EMULATOR_HOST can not be used with DESTINATION_TYPE %s.", DestinationTypeBigQuery))
+		}
+		if cfg.DynamicTopicAttribute != "" {
+			problems = append(problems, fmt.Sprintf("DYNAMIC_TOPIC_ATTRIBUTE can not be used with DESTINATION_TYPE %s.", DestinationTypeBigQuery))
+		}
+		if cfg.BigQueryFlushInterval <= 0 {
+			problems = append(problems, fmt.Sprintf("BQ_FLUSH_INTERVAL must be positive, got %s.", cfg.BigQueryFlushInterval))
+		}
+	case DestinationTypeHTTP:
+		if u, err := url.Parse(cfg.DestinationURL); err != nil || u.Scheme != "http" && u.Scheme != "https" || u.Host == "" {
+			problems = append(problems, fmt.Sprintf("DESTINATION_URL must be an http or https URL when DESTINATION_TYPE is %s, got %q.", DestinationTypeHTTP, cfg.DestinationURL))
+		}
+		if cfg.DynamicTopicAttribute != "" {
+			problems = append(problems, fmt.Sprintf("DYNAMIC_TOPIC_ATTRIBUTE can not be used with DESTINATION_TYPE %s.", DestinationTypeHTTP))
+		}
+		if cfg.DestinationTimeout <= 0 {
+			problems = append(problems, fmt.Sprintf("DESTINATION_TIMEOUT must be positive, got %s.", cfg.DestinationTimeout))
+		}
+	case DestinationTypeKafka:
+		if len(cfg.KafkaBrokers) == 0 {
+			problems = append(problems, fmt.Sprintf("KAFKA_BROKERS variable must be set when DESTINATION_TYPE is %s.", DestinationTypeKafka))
+		}
+		if cfg.DynamicTopicAttribute != "" {
+			problems = append(problems, fmt.Sprintf("DYNAMIC_TOPIC_ATTRIBUTE can not be used with DESTINATION_TYPE %s.", DestinationTypeKafka))
+		}
+		switch cfg.KafkaSASLMechanism {
+		case "":
+		case KafkaSASLPlain, KafkaSASLSCRAMSHA256, KafkaSASLSCRAMSHA512:
+			if cfg.KafkaSASLUsername == "" {
+				problems = append(problems, "KAFKA_SASL_USERNAME variable must be set when KAFKA_SASL_MECHANISM is set.")
+			}
+		default:
+			problems = append(problems, fmt.Sprintf("KAFKA_SASL_MECHANISM must be one of %s, %s or %s, got %q.", KafkaSASLPlain, KafkaSASLSCRAMSHA256, KafkaSASLSCRAMSHA512, cfg.KafkaSASLMechanism))
+		}
+		if cfg.KafkaCACertFile != "" && !cfg.KafkaTLS {
+			problems = append(problems, "KAFKA_TLS must be set when KAFKA_CA_CERT_FILE is set.")
+		}
+	default:
+		problems = append(problems, fmt.Sprintf("DESTINATION_TYPE must be one of %s, %s, %s, %s, %s or %s, got %q.", DestinationTypePubSub, DestinationTypePubSubLite, DestinationTypeFile, DestinationTypeBigQuery, DestinationTypeHTTP, DestinationTypeKafka, cfg.DestinationType))
+	}
+
+	if _, ok := flowControlBehaviors[cfg.FlowControlBehavior]; !ok {
+		problems = append(problems, fmt.Sprintf("FLOW_CONTROL_BEHAVIOR must be one of block, ignore or signal-error, got %q.", cfg.FlowControlBehavior))
+	}
+
+	switch cfg.FanOutMode {
+	case FanOutModeAll, FanOutModeAny:
+	default:
+		problems = append(problems, fmt.Sprintf("FAN_OUT_MODE must be one of %s or %s, got %q.", FanOutModeAll, FanOutModeAny, cfg.FanOutMode))
+	}
+
+	switch cfg.AckMode {
+	case AckModeOnSuccess, AckModeBeforePublish, AckModeAlways:
+	default:
+		problems = append(problems, fmt.Sprintf("ACK_MODE must be one of %s, %s or %s, got %q.", AckModeOnSuccess, AckModeBeforePublish, AckModeAlways, cfg.AckMode))
+	}
+
+	if (cfg.InputCodec == "") != (cfg.OutputCodec == "") {
+		problems = append(problems, "INPUT_CODEC and OUTPUT_CODEC must be set together.")
+	}
+	for _, codec := range []struct{ name, value string }{{"INPUT_CODEC", cfg.InputCodec}, {"OUTPUT_CODEC", cfg.OutputCodec}} {
+		if codec.value == "" {
+			continue
+		}
+		if _, err := newCodec(codec.value, *cfg); err != nil {
+			problems = append(problems, fmt.Sprintf("%s must be one of %s with its settings, got %q: %v.", codec.name, strings.Join(codecNames(), ", "), codec.value, err))
+		}
+	}
+
+	if cfg.ValidateSchema {
+		if cfg.SchemaFile == "" {
+			problems = append(problems, "SCHEMA_FILE must be set when VALIDATE_SCHEMA is set.")
+		}
+		switch cfg.SchemaEncoding {
+		case SchemaEncodingJSON, SchemaEncodingBinary:
+		default:
+			problems = append(problems, fmt.Sprintf("SCHEMA_ENCODING must be one of %s or %s, got %q.", SchemaEncodingJSON, SchemaEncodingBinary, cfg.SchemaEncoding))
+		}
+	}
+
+	if cfg.TopicTemplate != "" {
+		if cfg.DynamicTopicAttribute == "" {
+			problems = append(problems, "DYNAMIC_TOPIC_ATTRIBUTE variable must be set when TOPIC_TEMPLATE is set.")
+		} else if !strings.Contains(cfg.TopicTemplate, "{"+cfg.DynamicTopicAttribute+"}") {
+			problems = append(problems, fmt.Sprintf("TOPIC_TEMPLATE must contain {%s}.", cfg.DynamicTopicAttribute))
+		}
+	}
+
+	if cfg.FilterAttribute != "" && len(cfg.FilterValues) == 0 {
+		problems = append(problems, "FILTER_VALUES variable must be set when FILTER_ATTRIBUTE is set.")
+	}
+
+	if cfg.MirrorTopic {
+		switch cfg.DestinationType {
+		case DestinationTypePubSub, DestinationTypePubSubLite, DestinationTypeKafka:
+		default:
+			problems = append(problems, fmt.Sprintf("MIRROR_TOPIC can not be used with DESTINATION_TYPE %s.", cfg.DestinationType))
+		}
+		if cfg.DynamicTopicAttribute != "" {
+			problems = append(problems, "MIRROR_TOPIC and DYNAMIC_TOPIC_ATTRIBUTE are mutually exclusive.")
+		}
+		if cfg.KafkaTopic != "" {
+			problems = append(problems, "MIRROR_TOPIC and KAFKA_TOPIC are mutually exclusive.")
+		}
+	} else if cfg.MirrorTopicPrefix != "" || cfg.MirrorTopicSuffix != "" {
+		problems = append(problems, "MIRROR_TOPIC must be set when MIRROR_TOPIC_PREFIX or MIRROR_TOPIC_SUFFIX is set.")
+	}
+
+	if cfg.SampleRate <= 0 || cfg.SampleRate > 1 {
+		problems = append(problems, fmt.Sprintf("SAMPLE_RATE must be above 0 and at most 1, 1 forwarding every message, got %g.", cfg.SampleRate))
+	}
+	if cfg.SampleAttribute != "" && !cfg.SampleDeterministic {
+		problems = append(problems, "SAMPLE_DETERMINISTIC must be set when SAMPLE_ATTRIBUTE is set.")
+	}
+
+	if cfg.MinPublishTime != "" {
+		if _, err := time.Parse(time.RFC3339, cfg.MinPublishTime); err != nil {
+			problems = append(problems, fmt.Sprintf("MIN_PUBLISH_TIME must be a RFC3339 timestamp, got %q.", cfg.MinPublishTime))
+		}
+	}
+
+	if cfg.DataMatchRegex != "" {
+		if _, err := regexp.Compile(cfg.DataMatchRegex); err != nil {
+			problems = append(problems, fmt.Sprintf("DATA_MATCH_REGEX is not valid: %v", err))
+		}
+	}
+
+	if _, err := parseAttributeMapping(cfg.AttributeMapping); err != nil {
+		problems = append(problems, fmt.Sprintf("ATTRIBUTE_MAPPING is not valid: %v", err))
+	}
+
+	if _, err := parseAttributes(cfg.InjectAttributes); err != nil {
+		problems = append(problems, fmt.Sprintf("INJECT_ATTRIBUTES is not valid: %v", err))
+	}
+
+	if cfg.PreservePublishTime && cfg.PublishTimeAttribute == "" {
+		problems = append(problems, "PUBLISH_TIME_ATTRIBUTE must be set with PRESERVE_PUBLISH_TIME.")
+	}
+
+	if cfg.EnvelopeTemplate != "" {
+		if _, err := newEnvelope(cfg.EnvelopeTemplate); err != nil {
+			problems = append(problems, fmt.Sprintf("ENVELOPE_TEMPLATE is not valid: %v", err))
+		}
+	}
+
+	if cfg.TransformCEL != "" {
+		if _, err := newCELTransform(cfg.TransformCEL); err != nil {
+			problems = append(problems, fmt.Sprintf("TRANSFORM_CEL expression is not valid: %v", err))
+		}
+	}
+
+	return problems
+}
+
+// ValidateMappings returns the problems found when no mapping is configured
+// or when a mapping is incomplete
+func (cfg *Config) ValidateMappings() []string {
+	if len(cfg.Mappings) == 0 {
+		return []string{"PUBSUB_SUBSCRIPTION and PUBSUB_DESTINATION_TOPIC variables or a mappings list must be set."}
+	}
+
+	var problems []string
+	for i, m := range cfg.Mappings {
+		if m.SourceProject() == "" {
+			problems = append(problems, fmt.Sprintf("FROM_GOOGLE_CLOUD_PROJECT variable must be set (mapping %d).", i))
+		}
+		if m.DestinationProject() == "" {
+			problems = append(problems, fmt.Sprintf("TO_GOOGLE_CLOUD_PROJECT variable must be set (mapping %d).", i))
+		}
+		if m.PubSubSubscription == "" {
+			problems = append(problems, fmt.Sprintf("PUBSUB_SUBSCRIPTION variable must be set (mapping %d).", i))
+		} else if _, _, ok := parseResource(m.PubSubSubscription, collectionSubscriptions); !ok {
+			problems = append(problems, fmt.Sprintf("PUBSUB_SUBSCRIPTION must be a name or projects/<project>/subscriptions/<name>, got %q (mapping %d).", m.PubSubSubscription, i))
+		}
+		for _, name := range m.DestinationTopics() {
+			if _, _, ok := parseResource(name, collectionTopics); !ok {
+				problems = append(problems, fmt.Sprintf("PUBSUB_DESTINATION_TOPIC must be a name or projects/<project>/topics/<name>, got %q (mapping %d).", name, i))
+			}
+		}
+		switch {
+		case cfg.MirrorTopic:
+			if m.PubSubDestinationTopic != "" {
+				problems = append(problems, fmt.Sprintf("PUBSUB_DESTINATION_TOPIC can not be set when MIRROR_TOPIC is set (mapping %d).", i))
+			}
+		case m.PubSubDestinationTopic == "" && cfg.DynamicTopicAttribute == "" && cfg.DestinationType != DestinationTypeFile && cfg.DestinationType != DestinationTypeBigQuery && cfg.DestinationType != DestinationTypeHTTP &&
+			!(cfg.DestinationType == DestinationTypeKafka && cfg.KafkaTopic != ""):
+			problems = append(problems, fmt.Sprintf("PUBSUB_DESTINATION_TOPIC variable must be set (mapping %d).", i))
+		}
+		if m.PublishProfile != "" {
+			if _, ok := cfg.PublishProfiles[m.PublishProfile]; !ok {
+				problems = append(problems, fmt.Sprintf("publish-profile must be one of the publish-profiles, got %q (mapping %d).", m.PublishProfile, i))
+			} else if cfg.DestinationType != DestinationTypePubSub {
+				problems = append(problems, fmt.Sprintf("publish-profile can only be set with pubsub destinations (mapping %d).", i))
+			}
+		}
+	}
+	for name, p := range cfg.PublishProfiles {
+		if p.CountThreshold < 0 || p.CountThreshold > pubsub.MaxPublishRequestCount {
+			problems = append(problems, fmt.Sprintf("publish-count-threshold must be between 1 and %d, or 0 to inherit the global value, got %d (publish profile %s).", pubsub.MaxPublishRequestCount, p.CountThreshold, name))
+		}
+		if p.ByteThreshold < 0 {
+			problems = append(problems, fmt.Sprintf("publish-byte-threshold must be positive or 0 to inherit the global value, got %d (publish profile %s).", p.ByteThreshold, name))
+		}
+		if p.DelayThreshold < 0 {
+			problems = append(problems, fmt.Sprintf("publish-delay-threshold must be positive or 0 to inherit the global value, got %s (publish profile %s).", p.DelayThreshold, name))
+		}
+		if _, ok := flowControlBehaviors[p.FlowControlBehavior]; p.FlowControlBehavior != "" && !ok {
+			problems = append(problems, fmt.Sprintf("flow-control-behavior must be one of block, ignore or signal-error, got %q (publish profile %s).", p.FlowControlBehavior, name))
+		}
+		if p.FlowControlMaxMessages < 0 {
+			problems = append(problems, fmt.Sprintf("flow-control-max-messages must be positive or 0 to inherit the default, got %d (publish profile %s).", p.FlowControlMaxMessages, name))
+		}
+		if p.FlowControlMaxBytes < 0 {
+			problems = append(problems, fmt.Sprintf("flow-control-max-bytes must be positive or 0 to inherit the default, got %d (publish profile %s).", p.FlowControlMaxBytes, name))
+		}
+	}
+	return problems
+}
+
+// ValidateCredentials returns the problems found when parsing the configured
+// credentials. Application default credentials and Secret Manager secrets
+// are not looked up and credentials encrypted with Cloud KMS are only
+// checked to be readable.
+func (cfg *Config) ValidateCredentials(ctx context.Context) []string {
+	if cfg.EmulatorHost != "" {
+		return nil
+	}
+
+	var problems []string
+	for _, c := range []struct {
+		param, json, file, secret, kmsKey string
+	}{
+		{"from-google-application-credentials-json", cfg.FromGoogleApplicationCredentials, cfg.FromGoogleApplicationCredentialsFile, cfg.FromCredentialsSecret, cfg.FromCredentialsKMSKey},
+		{"to-google-application-credentials-json", cfg.ToGoogleApplicationCredentials, cfg.ToGoogleApplicationCredentialsFile, cfg.ToCredentialsSecret, cfg.ToCredentialsKMSKey},
+	} {
+		if c.secret != "" {
+			continue
+		}
+		if c.kmsKey != "" {
+			if c.json == "" && c.file == "" {
+				continue
+			}
+			if _, err := credentialsCiphertext(c.json, c.file); err != nil {
+				problems = append(problems, fmt.Sprintf("Could not read encrypted credentials from %s: %v", c.param, err))
+			}
+			continue
+		}
+		json := []byte(c.json)
+		if c.file != "" {
+			b, err := ioutil.ReadFile(c.file)
+			if err != nil {
+				problems = append(problems, fmt.Sprintf("Could not read credentials file %s: %v", c.file, err))
+				continue
+			}
+			json = b
+		}
+		if len(json) == 0 {
+			continue
+		}
+		if _, err := google.CredentialsFromJSON(ctx, json, pubsub.ScopePubSub); err != nil {
+			problems = append(problems, fmt.Sprintf("Could not find credentials from %s: %v", c.param, err))
+		}
+	}
+	return problems
+}
@@ -0,0 +1,34 @@
+package forwarder
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestValidateAttributeMapping(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		mapping []string
+		wantErr bool
+	}{
+		{name: "renames", mapping: []string{"tenant=x-tenant", "trace=x-trace"}},
+		{name: "drops", mapping: []string{"tenant=", "trace="}},
+		{name: "duplicate target", mapping: []string{"tenant=x-id", "trace=x-id"}, wantErr: true},
+		{name: "attribute mapped twice", mapping: []string{"tenant=x-tenant", "tenant=x-other"}, wantErr: true},
+		{name: "not a pair", mapping: []string{"tenant"}, wantErr: true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			cfg := testConfig()
+			cfg.AttributeMapping = tc.mapping
+			var mappingProblems []string
+			for _, p := range cfg.Validate() {
+				if strings.HasPrefix(p, "ATTRIBUTE_MAPPING") {
+					mappingProblems = append(mappingProblems, p)
+				}
+			}
+			if gotErr := len(mappingProblems) > 0; gotErr != tc.wantErr {
+				t.Errorf("Validate() attribute mapping problems = %v, want problems %t", mappingProblems, tc.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,119 @@
+package forwarder
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"cloud.google.com/go/pubsub"
+	"golang.org/x/net/http/httpguts"
+)
+
+const (
+	// webhookAttributeHeaderPrefix prefixes the headers holding the message
+	// attributes
+	webhookAttributeHeaderPrefix = "X-PubSub-Attr-"
+	webhookMessageIDHeader       = "X-PubSub-Message-Id"
+	// webhookErrorBodyBytes is the size of the response body kept in errors
+	webhookErrorBodyBytes = 512
+)
+
+// asyncResult is the result of a publish done in its own goroutine, known
+// once done is closed
+type asyncResult struct {
+	done chan struct{}
+	err  error
+}
+
+func (r *asyncResult) Get(ctx context.Context) (string, error) {
+	select {
+	case <-r.done:
+		return "", r.err
+	case <-ctx.Done():
+		return "", ctx.Err()
+	}
+}
+
+// webhookPublisher posts each message body to an HTTP endpoint, the
+// attributes as headers. 4xx responses but 408 and 429 reject the message,
+// other non 2xx responses fail its publish.
+type webhookPublisher struct {
+	url    string
+	token  string
+	client *http.Client
+}
+
+func newWebhookPublisher(url, token string, timeout time.Duration) *webhookPublisher {
+	return &webhookPublisher{
+		url:    url,
+		token:  token,
+		client: &http.Client{Timeout: timeout},
+	}
+}
+
+func (p *webhookPublisher) Publish(ctx context.Context, msg *pubsub.Message) publishResult {
+	res := &asyncResult{done: make(chan struct{})}
+	go func() {
+		defer close(res.done)
+		res.err = p.post(ctx, msg)
+	}()
+	return res
+}
+
+// post sends msg to the endpoint
+func (p *webhookPublisher) post(ctx context.Context, msg *pubsub.Message) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.url, bytes.NewReader(msg.Data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/octet-stream")
+	req.Header.Set(webhookMessageIDHeader, msg.ID)
+	if p.token != "" {
+		req.Header.Set("Authorization", "Bearer "+p.token)
+	}
+	for k, v := range msg.Attributes {
+		name := webhookAttributeHeaderPrefix + k
+		if !httpguts.ValidHeaderFieldName(name) || !httpguts.ValidHeaderFieldValue(v) {
+			return &rejectedError{fmt.Errorf("attribute %q can not be sent as a header", k)}
+		}
+		// set as is, attribute names being case sensitive
+		req.Header[name] = []string{v}
+	}
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, webhookErrorBodyBytes))
+	_, _ = io.Copy(io.Discard, resp.Body)
+
+	switch {
+	case resp.StatusCode >= 200 && resp.StatusCode < 300:
+		return nil
+	case resp.StatusCode == http.StatusRequestTimeout || resp.StatusCode == http.StatusTooManyRequests:
+	case resp.StatusCode >= 400 && resp.StatusCode < 500:
+		return &rejectedError{fmt.Errorf("endpoint rejected the message with %s", responseSummary(resp.Status, body))}
+	}
+	return fmt.Errorf("endpoint responded %s", responseSummary(resp.Status, body))
+}
+
+// responseSummary returns the status of a response followed by the start
+// of its body, if any
+func responseSummary(status string, body []byte) string {
+	if len(body) == 0 {
+		return status
+	}
+	return fmt.Sprintf("%s: %s", status, body)
+}
+
+func (p *webhookPublisher) Stop() {
+	p.client.CloseIdleConnections()
+}
+
+func (p *webhookPublisher) String() string {
+	return p.url
+}
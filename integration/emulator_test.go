@@ -0,0 +1,169 @@
+// Package integration runs the forwarder against the pubsub emulator. The
+// tests are skipped unless PUBSUB_EMULATOR_HOST is set, e.g. after
+//
+//	gcloud beta emulators pubsub start --host-port=localhost:8085
+//	export PUBSUB_EMULATOR_HOST=localhost:8085
+package integration
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"cloud.google.com/go/pubsub"
+	"github.com/karnott/pubsub-to-pubsub/forwarder"
+)
+
+const (
+	project = "integration"
+	// messageCount is the number of messages forwarded by the test
+	messageCount = 100
+	timeout      = 30 * time.Second
+)
+
+func TestForwardAttributes(t *testing.T) {
+	host := os.Getenv(forwarder.EmulatorHostEnv)
+	if host == "" {
+		t.Skipf("%s is not set", forwarder.EmulatorHostEnv)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	// the pubsub client connects to the emulator of the variable
+	client, err := pubsub.NewClient(ctx, project)
+	if err != nil {
+		t.Fatalf("pubsub.NewClient() error = %v", err)
+	}
+	defer client.Close()
+
+	// the emulator keeps the resources of previous runs
+	suffix := strconv.FormatInt(time.Now().UnixNano(), 36)
+	src := createTopic(ctx, t, client, "src-"+suffix)
+	createSubscription(ctx, t, client, "src-sub-"+suffix, src)
+	dst := createTopic(ctx, t, client, "dst-"+suffix)
+	dstSub := createSubscription(ctx, t, client, "dst-sub-"+suffix, dst)
+
+	fw, err := forwarder.NewWithClients(client, client, forwarder.Config{
+		Mappings: []forwarder.Mapping{{
+			PubSubSubscription:     "src-sub-" + suffix,
+			PubSubDestinationTopic: "dst-" + suffix,
+			FromGoogleCloudProject: project,
+			ToGoogleCloudProject:   project,
+		}},
+		EmulatorHost:           host,
+		ShutdownTimeout:        5 * time.Second,
+		PublishCountThreshold:  pubsub.DefaultPublishSettings.CountThreshold,
+		PublishByteThreshold:   pubsub.DefaultPublishSettings.ByteThreshold,
+		PublishDelayThreshold:  pubsub.DefaultPublishSettings.DelayThreshold,
+		MaxOutstandingMessages: messageCount,
+		MaxOutstandingBytes:    pubsub.DefaultReceiveSettings.MaxOutstandingBytes,
+		ReceiveGoroutines:      1,
+		DestinationType:        forwarder.DestinationTypePubSub,
+		FanOutMode:             forwarder.FanOutModeAll,
+		AckMode:                forwarder.AckModeOnSuccess,
+		FlowControlBehavior:    forwarder.FlowControlBlock,
+		PublishMaxAttempts:     1,
+		SampleRate:             1,
+	})
+	if err != nil {
+		t.Fatalf("forwarder.NewWithClients() error = %v", err)
+	}
+	runCtx, stop := context.WithCancel(ctx)
+	done := make(chan error, 1)
+	go func() { done <- fw.Run(runCtx) }()
+	defer func() {
+		stop()
+		if err := <-done; err != nil {
+			t.Errorf("Run() error = %v", err)
+		}
+	}()
+
+	var results []*pubsub.PublishResult
+	for i := 0; i < messageCount; i++ {
+		results = append(results, src.Publish(ctx, &pubsub.Message{
+			Data:       []byte(fmt.Sprintf("message %d", i)),
+			Attributes: attributes(i),
+		}))
+	}
+	for _, res := range results {
+		if _, err := res.Get(ctx); err != nil {
+			t.Fatalf("Publish() error = %v", err)
+		}
+	}
+
+	var (
+		mu       sync.Mutex
+		received = map[string]*pubsub.Message{}
+	)
+	recvCtx, stopReceive := context.WithCancel(ctx)
+	defer stopReceive()
+	err = dstSub.Receive(recvCtx, func(_ context.Context, msg *pubsub.Message) {
+		msg.Ack()
+		mu.Lock()
+		defer mu.Unlock()
+		// redeliveries are counted once
+		received[msg.Attributes["seq"]] = msg
+		if len(received) == messageCount {
+			stopReceive()
+		}
+	})
+	if err != nil {
+		t.Fatalf("Receive() error = %v", err)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(received) != messageCount {
+		t.Fatalf("%d of %d messages forwarded", len(received), messageCount)
+	}
+	for i := 0; i < messageCount; i++ {
+		msg := received[strconv.Itoa(i)]
+		if want := fmt.Sprintf("message %d", i); string(msg.Data) != want {
+			t.Errorf("message %d data = %q, want %q", i, msg.Data, want)
+		}
+		for k, v := range attributes(i) {
+			if msg.Attributes[k] != v {
+				t.Errorf("message %d attribute %s = %q, want %q", i, k, msg.Attributes[k], v)
+			}
+		}
+		if len(msg.Attributes) != len(attributes(i)) {
+			t.Errorf("message %d attributes = %v, want %v", i, msg.Attributes, attributes(i))
+		}
+	}
+}
+
+// attributes returns the attributes of the i-th message
+func attributes(i int) map[string]string {
+	return map[string]string{
+		"seq":    strconv.Itoa(i),
+		"parity": strconv.Itoa(i % 2),
+		"empty":  "",
+	}
+}
+
+func createTopic(ctx context.Context, t *testing.T, client *pubsub.Client, id string) *pubsub.Topic {
+	t.Helper()
+	topic, err := client.CreateTopic(ctx, id)
+	if err != nil {
+		t.Fatalf("CreateTopic(%s) error = %v", id, err)
+	}
+	t.Cleanup(func() {
+		topic.Stop()
+		_ = topic.Delete(context.Background())
+	})
+	return topic
+}
+
+func createSubscription(ctx context.Context, t *testing.T, client *pubsub.Client, id string, topic *pubsub.Topic) *pubsub.Subscription {
+	t.Helper()
+	sub, err := client.CreateSubscription(ctx, id, pubsub.SubscriptionConfig{Topic: topic})
+	if err != nil {
+		t.Fatalf("CreateSubscription(%s) error = %v", id, err)
+	}
+	t.Cleanup(func() { _ = sub.Delete(context.Background()) })
+	return sub
+}
@@ -1,34 +1,213 @@
 package util
 
 import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+
 	"github.com/sirupsen/logrus"
 )
 
-// SetLogger set an instance of logrus
-func SetLogger(ll, lf string) {
-	// set format
+// timestamp formats of SetLogger, other values being time layouts
+const (
+	TimestampRFC3339     = "rfc3339"
+	TimestampRFC3339Nano = "rfc3339nano"
+	// TimestampEpoch logs milliseconds since the epoch, json format only
+	TimestampEpoch = "epoch"
+)
+
+// log formats of SetLogger, other values being logged as text
+const (
+	LogFormatJSON = "json"
+	LogFormatText = "text"
+)
+
+var (
+	// formatMu guards the log format and the timestamp format it was set
+	// with, for SetLogFormat to change the format only
+	formatMu        sync.Mutex
+	logFormat       string
+	timestampFormat string
+)
+
+// SetLogger set an instance of logrus, writing to output: stdout, stderr or
+// the path of a file logs are appended to. The key=value pairs of fields are
+// added to every log line, timestamps being formatted with ts.
+func SetLogger(ll, lf, ts, output string, reportCaller bool, fields []string) {
+	formatMu.Lock()
+	setFormatter(lf, ts)
+	formatMu.Unlock()
+
+	logrus.SetReportCaller(reportCaller)
+
+	switch output {
+	case "", "stderr":
+		logrus.SetOutput(os.Stderr)
+	case "stdout":
+		logrus.SetOutput(os.Stdout)
+	default:
+		file, err := os.OpenFile(output, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+		if err != nil {
+			logrus.Errorf("log output %s can not be opened, logging to stderr : %v", output, err.Error())
+			logrus.SetOutput(os.Stderr)
+		} else {
+			logrus.SetOutput(file)
+		}
+	}
+
+	static, err := parseFields(fields)
+	if err != nil {
+		logrus.Errorf("log fields are not ok, logging without them : %v", err.Error())
+		static = nil
+	}
+	hooks := make(logrus.LevelHooks)
+	if len(static) > 0 {
+		hooks.Add(staticFieldsHook(static))
+	}
+	logrus.StandardLogger().ReplaceHooks(hooks)
+
+	logLevel, err := logrus.ParseLevel(ll)
+	if err != nil {
+		logrus.Errorf("log level is not ok, setting to info by default : %v", err.Error())
+		logrus.SetLevel(logrus.InfoLevel)
+	} else {
+		logrus.SetLevel(logLevel)
+	}
+}
+
+// SetLogFormat changes the log format to json or text, keeping the other
+// settings of SetLogger
+func SetLogFormat(lf string) error {
+	if lf != LogFormatJSON && lf != LogFormatText {
+		return fmt.Errorf("log format must be %s or %s, got %q", LogFormatJSON, LogFormatText, lf)
+	}
+	formatMu.Lock()
+	defer formatMu.Unlock()
+	setFormatter(lf, timestampFormat)
+	return nil
+}
+
+// LogFormat returns the current log format, json or text
+func LogFormat() string {
+	formatMu.Lock()
+	defer formatMu.Unlock()
+	return logFormat
+}
+
+// setFormatter sets the formatter of the lf format with ts timestamps, to be
+// called with formatMu held
+func setFormatter(lf, ts string) {
+	layout := time.RFC3339
+	switch ts {
+	case "", TimestampRFC3339, TimestampEpoch:
+	case TimestampRFC3339Nano:
+		layout = time.RFC3339Nano
+	default:
+		layout = ts
+	}
+
 	switch lf {
-	case "json":
-		logrus.SetFormatter(&logrus.JSONFormatter{
+	case LogFormatJSON:
+		f := &logrus.JSONFormatter{
+			TimestampFormat: layout,
 			FieldMap: logrus.FieldMap{
 				logrus.FieldKeyLevel: "severity",
 				logrus.FieldKeyMsg:   "message",
+				logrus.FieldKeyFile:  "caller",
 			},
-		})
+			CallerPrettyfier: callerPrettyfier,
+		}
+		if ts == TimestampEpoch {
+			logrus.SetFormatter(newEpochFormatter(f))
+		} else {
+			logrus.SetFormatter(f)
+		}
 	default:
 		logrus.SetFormatter(&logrus.TextFormatter{
 			QuoteEmptyFields:       true,
 			FullTimestamp:          true,
+			TimestampFormat:        layout,
 			ForceColors:            true,
 			DisableLevelTruncation: true,
+			CallerPrettyfier:       callerPrettyfier,
 		})
+		if ts == TimestampEpoch {
+			logrus.Errorf("log timestamp format %s is only supported by the json format, using %s", TimestampEpoch, TimestampRFC3339)
+		}
+		lf = LogFormatText
 	}
+	logFormat, timestampFormat = lf, ts
+}
 
-	logLevel, err := logrus.ParseLevel(ll)
-	if err != nil {
-		logrus.Errorf("log level is not ok, setting to info by default : %v", err.Error())
-		logrus.SetLevel(logrus.InfoLevel)
-	} else {
-		logrus.SetLevel(logLevel)
+// callerPrettyfier reports the caller as a compact file:line, without the function
+func callerPrettyfier(f *runtime.Frame) (string, string) {
+	return "", fmt.Sprintf("%s:%d", filepath.Base(f.File), f.Line)
+}
+
+// staticFieldsHook adds its fields to every log entry, fields of the entry
+// taking precedence
+type staticFieldsHook logrus.Fields
+
+func (h staticFieldsHook) Levels() []logrus.Level {
+	return logrus.AllLevels
+}
+
+func (h staticFieldsHook) Fire(entry *logrus.Entry) error {
+	for k, v := range h {
+		if _, ok := entry.Data[k]; !ok {
+			entry.Data[k] = v
+		}
+	}
+	return nil
+}
+
+// parseFields parses key=value pairs into log fields
+func parseFields(pairs []string) (logrus.Fields, error) {
+	fields := make(logrus.Fields, len(pairs))
+	for _, pair := range pairs {
+		kv := strings.SplitN(pair, "=", 2)
+		if len(kv) != 2 || kv[0] == "" {
+			return nil, fmt.Errorf("%q is not a key=value pair", pair)
+		}
+		fields[kv[0]] = kv[1]
+	}
+	return fields, nil
+}
+
+// epochFormatter formats entries as its JSON formatter does, the time being
+// milliseconds since the epoch
+type epochFormatter struct {
+	json *logrus.JSONFormatter
+}
+
+func newEpochFormatter(f *logrus.JSONFormatter) *epochFormatter {
+	inner := *f
+	// the time is added as a field, so the formatter must neither write it
+	// nor rename it as a clashing field
+	inner.DisableTimestamp = true
+	inner.FieldMap = logrus.FieldMap{logrus.FieldKeyTime: ""}
+	for k, v := range f.FieldMap {
+		if k != logrus.FieldKeyTime {
+			inner.FieldMap[k] = v
+		}
+	}
+	return &epochFormatter{json: &inner}
+}
+
+func (f *epochFormatter) Format(entry *logrus.Entry) ([]byte, error) {
+	data := make(logrus.Fields, len(entry.Data)+1)
+	for k, v := range entry.Data {
+		if k == logrus.FieldKeyTime {
+			k = "fields." + k
+		}
+		data[k] = v
 	}
+	data[logrus.FieldKeyTime] = entry.Time.UnixNano() / int64(time.Millisecond)
+	e := *entry
+	e.Data = data
+	return f.json.Format(&e)
 }
@@ -0,0 +1,157 @@
+package util
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+
+	"cloud.google.com/go/logging"
+	"github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel/trace"
+	"golang.org/x/oauth2/google"
+	mrpb "google.golang.org/genproto/googleapis/api/monitoredres"
+	logpb "google.golang.org/genproto/googleapis/logging/v2"
+)
+
+// log sinks of SetLogSink
+const (
+	// LogSinkOutput writes the formatted logs to the log output
+	LogSinkOutput = "output"
+	// LogSinkStackdriver sends the logs to Cloud Logging
+	LogSinkStackdriver = "stackdriver"
+)
+
+// logSink is the Cloud Logging client of the stackdriver sink, nil with the
+// output sink
+var logSink *logging.Client
+
+// SetLogSink sends the logs to sink. With LogSinkStackdriver, the entries are
+// written to the logName log of project, the project of the Application
+// Default Credentials when empty, with the monitored resource of type
+// resourceType and the key=value resourceLabels, instead of being written to
+// the log output. The sink falls back to the log output when it can not be
+// set up.
+func SetLogSink(sink, project, logName, resourceType string, resourceLabels []string) {
+	switch sink {
+	case "", LogSinkOutput:
+		return
+	case LogSinkStackdriver:
+	default:
+		logrus.Errorf("log sink %s is not ok, logging to the log output", sink)
+		return
+	}
+
+	hook, err := newStackdriverHook(project, logName, resourceType, resourceLabels)
+	if err != nil {
+		logrus.Errorf("log sink %s can not be set up, logging to the log output : %v", sink, err.Error())
+		return
+	}
+	logrus.AddHook(hook)
+	logrus.SetOutput(io.Discard)
+	logrus.RegisterExitHandler(CloseLogSink)
+}
+
+// CloseLogSink flushes the entries buffered by the log sink, it can be called
+// more than once
+func CloseLogSink() {
+	if logSink == nil {
+		return
+	}
+	if err := logSink.Close(); err != nil {
+		fmt.Fprintf(os.Stderr, "could not flush logs to Cloud Logging: %v\n", err)
+	}
+	logSink = nil
+}
+
+// stackdriverHook writes the log entries to a Cloud Logging log
+type stackdriverHook struct {
+	logger  *logging.Logger
+	project string
+}
+
+func newStackdriverHook(project, logName, resourceType string, resourceLabels []string) (*stackdriverHook, error) {
+	ctx := context.Background()
+	if project == "" {
+		creds, err := google.FindDefaultCredentials(ctx, logging.WriteScope)
+		if err != nil {
+			return nil, err
+		}
+		if creds.ProjectID == "" {
+			return nil, fmt.Errorf("the log project must be set, the default credentials having no project")
+		}
+		project = creds.ProjectID
+	}
+	labels, err := parseFields(resourceLabels)
+	if err != nil {
+		return nil, fmt.Errorf("resource labels are not ok: %w", err)
+	}
+	resource := &mrpb.MonitoredResource{Type: resourceType, Labels: make(map[string]string, len(labels))}
+	for k, v := range labels {
+		resource.Labels[k] = fmt.Sprint(v)
+	}
+
+	client, err := logging.NewClient(ctx, "projects/"+project)
+	if err != nil {
+		return nil, err
+	}
+	// the logs can not report their own failures
+	client.OnError = func(err error) {
+		fmt.Fprintf(os.Stderr, "could not write logs to Cloud Logging: %v\n", err)
+	}
+	logSink = client
+	return &stackdriverHook{
+		logger:  client.Logger(logName, logging.CommonResource(resource)),
+		project: project,
+	}, nil
+}
+
+func (h *stackdriverHook) Levels() []logrus.Level {
+	return logrus.AllLevels
+}
+
+func (h *stackdriverHook) Fire(entry *logrus.Entry) error {
+	payload := make(map[string]interface{}, len(entry.Data)+1)
+	for k, v := range entry.Data {
+		// errors are not marshalled to JSON, as done by the JSON formatter
+		if err, ok := v.(error); ok {
+			v = err.Error()
+		}
+		payload[k] = v
+	}
+	payload["message"] = entry.Message
+
+	e := logging.Entry{
+		Timestamp: entry.Time,
+		Severity:  severities[entry.Level],
+		Payload:   payload,
+	}
+	if entry.HasCaller() {
+		e.SourceLocation = &logpb.LogEntrySourceLocation{
+			File:     entry.Caller.File,
+			Line:     int64(entry.Caller.Line),
+			Function: entry.Caller.Function,
+		}
+	}
+	// entries logged with the context of a span are correlated to its trace
+	if entry.Context != nil {
+		if span := trace.SpanContextFromContext(entry.Context); span.IsValid() {
+			e.Trace = fmt.Sprintf("projects/%s/traces/%s", h.project, span.TraceID())
+			e.SpanID = span.SpanID().String()
+			e.TraceSampled = span.IsSampled()
+		}
+	}
+	h.logger.Log(e)
+	return nil
+}
+
+// severities are the Cloud Logging severities of the logrus levels
+var severities = map[logrus.Level]logging.Severity{
+	logrus.TraceLevel: logging.Debug,
+	logrus.DebugLevel: logging.Debug,
+	logrus.InfoLevel:  logging.Info,
+	logrus.WarnLevel:  logging.Warning,
+	logrus.ErrorLevel: logging.Error,
+	logrus.FatalLevel: logging.Critical,
+	logrus.PanicLevel: logging.Alert,
+}